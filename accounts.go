@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/baely/balance/internal/database"
+	"github.com/baely/balance/internal/service"
+	"github.com/baely/balance/pkg/model"
+)
+
+const defaultHistoryRange = 30 * 24 * time.Hour
+
+func (s *Server) ListAccounts(w http.ResponseWriter, r *http.Request) {
+	balances, err := s.store.ListAccountBalances()
+	if err != nil {
+		fmt.Println("database error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	if balances == nil {
+		balances = []model.AccountBalance{}
+	}
+
+	writeJSON(w, http.StatusOK, balances)
+}
+
+func (s *Server) GetBalanceAt(w http.ResponseWriter, r *http.Request) {
+	accountId := chi.URLParam(r, "accountId")
+
+	at, err := parseTime(r.URL.Query().Get("at"), time.Now())
+	if err != nil {
+		http.Error(w, "invalid at", http.StatusBadRequest)
+		return
+	}
+
+	snapshot, err := s.store.GetBalanceAt(accountId, at)
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("database error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+// GetBalanceHistory returns the balance snapshots of an account between from
+// and to. When interval is set, the closing balance of each day, week or
+// month is returned instead.
+func (s *Server) GetBalanceHistory(w http.ResponseWriter, r *http.Request) {
+	accountId := chi.URLParam(r, "accountId")
+	query := r.URL.Query()
+
+	to, err := parseTime(query.Get("to"), time.Now())
+	if err != nil {
+		http.Error(w, "invalid to", http.StatusBadRequest)
+		return
+	}
+
+	from, err := parseTime(query.Get("from"), to.Add(-defaultHistoryRange))
+	if err != nil || !from.Before(to) {
+		http.Error(w, "invalid from", http.StatusBadRequest)
+		return
+	}
+
+	snapshots, err := s.store.ListBalanceSnapshots(accountId, from, to)
+	if err != nil {
+		fmt.Println("database error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	if query.Get("interval") == "" {
+		if snapshots == nil {
+			snapshots = []model.BalanceSnapshot{}
+		}
+		writeJSON(w, http.StatusOK, snapshots)
+		return
+	}
+
+	interval, err := service.ParseInterval(query.Get("interval"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	loc := time.UTC
+	if tz := query.Get("tz"); tz != "" {
+		loc, err = time.LoadLocation(tz)
+		if err != nil {
+			http.Error(w, "invalid tz", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var opening *model.BalanceSnapshot
+	snapshot, err := s.store.GetBalanceAt(accountId, from)
+	if err == nil {
+		opening = &snapshot
+	} else if !errors.Is(err, database.ErrNotFound) {
+		fmt.Println("database error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	points, err := service.BucketBalanceHistory(opening, snapshots, interval, from, to, loc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, points)
+}
+
+func parseTime(s string, fallback time.Time) (time.Time, error) {
+	if s == "" {
+		return fallback, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+func TestAccountsRequireAdmin(t *testing.T) {
+	env := newTestEnv(t)
+
+	for _, path := range []string{
+		"/accounts",
+		"/accounts/" + spendingAccountId + "/balance",
+		"/accounts/" + spendingAccountId + "/history",
+	} {
+		if status := env.request(t, "", http.MethodGet, path, nil, nil); status != http.StatusUnauthorized {
+			t.Errorf("GET %s = %d without a token, want %d", path, status, http.StatusUnauthorized)
+		}
+	}
+
+	// The widget's balance stays public
+	err := env.store.UpdateAccountBalance(model.AccountBalance{
+		AccountId:     spendingAccountId,
+		AccountType:   "TRANSACTIONAL",
+		OwnershipType: "INDIVIDUAL",
+		Balance:       "12.34",
+		AsOf:          time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(env.service.URL + "/account-balance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "12.34" {
+		t.Errorf("GET /account-balance = %d %q, want 200 \"12.34\"", resp.StatusCode, body)
+	}
+}
+
+func TestBalanceHistory(t *testing.T) {
+	env := newTestEnv(t)
+
+	melbourne, err := time.LoadLocation("Australia/Melbourne")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.January, day, hour, minute, 0, 0, melbourne)
+	}
+
+	for i, snapshot := range []struct {
+		at      time.Time
+		balance int
+	}{
+		{at(0, 12, 0), 10000}, // 31 December, before the range
+		{at(1, 9, 0), 9000},
+		{at(1, 18, 0), 8000},
+		{at(2, 0, 30), 7000}, // Still 1 January in UTC
+		{at(3, 10, 0), 12000},
+	} {
+		err := env.store.AddBalanceSnapshot(model.BalanceSnapshot{
+			AccountId:        spendingAccountId,
+			TransactionId:    string(rune('a' + i)),
+			ValueInBaseUnits: snapshot.balance,
+			CurrencyCode:     "AUD",
+			CreatedAt:        snapshot.at,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := "/accounts/" + spendingAccountId + "/history?from=" + url.QueryEscape(at(1, 0, 0).Format(time.RFC3339)) + "&to=" + url.QueryEscape(at(4, 0, 0).Format(time.RFC3339))
+
+	var snapshots []model.BalanceSnapshot
+	if status := env.admin(t, http.MethodGet, path, nil, &snapshots); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	if len(snapshots) != 4 {
+		t.Errorf("got %d snapshots, want 4", len(snapshots))
+	}
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		// Days in Melbourne carry the last balance forward
+		{query: "&interval=day&tz=Australia/Melbourne", want: []int{8000, 7000, 12000}},
+		// In UTC the range starts at 13:00 on 31 December
+		{query: "&interval=day", want: []int{9000, 7000, 12000, 12000}},
+		{query: "&interval=month&tz=Australia/Melbourne", want: []int{12000}},
+	}
+
+	for _, tt := range tests {
+		var points []model.BalanceHistoryPoint
+		if status := env.admin(t, http.MethodGet, path+tt.query, nil, &points); status != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", tt.query, status, http.StatusOK)
+		}
+
+		var got []int
+		for _, point := range points {
+			got = append(got, point.ValueInBaseUnits)
+		}
+		if !equalInts(got, tt.want) {
+			t.Errorf("%s: closing balances = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	for _, query := range []string{"&interval=hour", "&interval=day&tz=Nowhere/Special"} {
+		if status := env.admin(t, http.MethodGet, path+query, nil, nil); status != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", query, status, http.StatusBadRequest)
+		}
+	}
+
+	var snapshot model.BalanceSnapshot
+	if status := env.admin(t, http.MethodGet, "/accounts/"+spendingAccountId+"/balance?at="+url.QueryEscape(at(2, 12, 0).Format(time.RFC3339)), nil, &snapshot); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	if snapshot.ValueInBaseUnits != 7000 {
+		t.Errorf("balance at noon on 2 January = %d, want 7000", snapshot.ValueInBaseUnits)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
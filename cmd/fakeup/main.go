@@ -0,0 +1,47 @@
+// Command fakeup serves a fake Up API for local development. Point the
+// service at it with UP_API_URL=http://localhost:9000/api/v1/.
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/baely/balance/pkg/up/uptest"
+)
+
+func main() {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "9000"
+	}
+
+	fixtures := uptest.DefaultFixtures()
+	if path := os.Getenv("FAKE_UP_FIXTURES"); path != "" {
+		var err error
+		if fixtures, err = uptest.LoadFixtures(path); err != nil {
+			panic(err)
+		}
+	}
+
+	s := uptest.New(fixtures)
+
+	// Events are signed with UP_WEBHOOK_SECRET so the service accepts them
+	if webhookUrl := os.Getenv("FAKE_UP_WEBHOOK_URL"); webhookUrl != "" {
+		webhook := s.AddWebhook(webhookUrl, os.Getenv("UP_WEBHOOK_SECRET"))
+		fmt.Println("Registered webhook", webhook.Id, "for", webhookUrl)
+	}
+
+	if path := os.Getenv("FAKE_UP_FAULTS"); path != "" {
+		faults, err := uptest.LoadFaults(path)
+		if err != nil {
+			panic(err)
+		}
+		s.Inject(faults...)
+	}
+
+	fmt.Println("Fake Up API listening on port", port)
+	if err := http.ListenAndServe(fmt.Sprintf(":%s", port), s); err != nil {
+		panic(err)
+	}
+}
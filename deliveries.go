@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+
+	"github.com/baely/balance/internal/database"
+	"github.com/baely/balance/internal/delivery"
+	"github.com/baely/balance/pkg/model"
+)
+
+const defaultListLimit = 100
+
+func (s *Server) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := s.store.ListDeliveries(model.DeliveryDead, limit)
+	if err != nil {
+		fmt.Println("database error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	if deliveries == nil {
+		deliveries = []model.Delivery{}
+	}
+
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+func (s *Server) GetDeadLetter(w http.ResponseWriter, r *http.Request) {
+	d, err := s.store.GetDelivery(chi.URLParam(r, "deliveryId"))
+	if errors.Is(err, database.ErrNotFound) || (err == nil && d.Status != model.DeliveryDead) {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("database error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, d)
+}
+
+func (s *Server) RedriveDeadLetter(w http.ResponseWriter, r *http.Request) {
+	d, err := s.dispatcher.Redrive(r.Context(), chi.URLParam(r, "deliveryId"))
+	if errors.Is(err, database.ErrNotFound) || errors.Is(err, delivery.ErrNotDead) {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("database error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, d)
+}
+
+// RetryDeliveries attempts the deliveries whose retry is due. It is meant to
+// be called on a schedule where the background retry loop gets no CPU.
+func (s *Server) RetryDeliveries(w http.ResponseWriter, r *http.Request) {
+	attempted := s.dispatcher.RetryDue(r.Context())
+
+	writeJSON(w, http.StatusOK, map[string]int{"attempted": attempted})
+}
+
+// ListSubscriptionDeliveries returns the most recent delivery attempts to a
+// subscription.
+func (s *Server) ListSubscriptionDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	subscriptionId := chi.URLParam(r, "subscriptionId")
+	if _, err := s.store.GetSubscription(subscriptionId); errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	} else if err != nil {
+		fmt.Println("database error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	attempts, err := s.store.ListDeliveryAttempts(subscriptionId, limit)
+	if err != nil {
+		fmt.Println("database error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	if attempts == nil {
+		attempts = []model.DeliveryAttempt{}
+	}
+
+	writeJSON(w, http.StatusOK, attempts)
+}
+
+func (s *Server) RedeliverEvent(w http.ResponseWriter, r *http.Request) {
+	d, err := s.dispatcher.Redeliver(r.Context(), chi.URLParam(r, "subscriptionId"), chi.URLParam(r, "eventId"))
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("database error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, d)
+}
+
+func parseLimit(s string) (int, error) {
+	if s == "" {
+		return defaultListLimit, nil
+	}
+
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("invalid limit: %q", s)
+	}
+
+	return limit, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/baely/balance/internal/delivery"
+	"github.com/baely/balance/pkg/model"
+)
+
+func TestRedeliverEvent(t *testing.T) {
+	env := newTestEnv(t)
+
+	// The first request fails, and every later one succeeds
+	var calls atomic.Int32
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	t.Cleanup(subscriber.Close)
+
+	subscription := model.Subscription{Id: "sub_1", Type: model.SubscriptionRaw, Uri: subscriber.URL, Enabled: true}
+	if err := env.store.AddSubscription(subscription); err != nil {
+		t.Fatal(err)
+	}
+
+	err := env.server.dispatcher.Deliver(context.Background(), "evt_1", []delivery.Target{{
+		Subscription: subscription,
+		Payload:      delivery.Payload{Body: []byte(`{}`), ContentType: "application/json"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, err := env.store.GetEventDelivery(subscription.Id, "evt_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var redelivered model.Delivery
+	if status := env.admin(t, http.MethodPost, "/subscriptions/sub_1/deliveries/evt_1/redeliver", nil, &redelivered); status != http.StatusOK {
+		t.Fatalf("redeliver status = %d, want %d", status, http.StatusOK)
+	}
+	if redelivered.Id == original.Id || redelivered.Status != model.DeliverySucceeded || redelivered.Payload != original.Payload {
+		t.Errorf("redelivered %+v, want a new succeeded delivery of the original payload", redelivered)
+	}
+
+	// The original is left to its own retries
+	if original, err = env.store.GetDelivery(original.Id); err != nil {
+		t.Fatal(err)
+	}
+	if original.Status != model.DeliveryPending || original.Attempts != 1 {
+		t.Errorf("original is %s after %d attempts, want pending after 1", original.Status, original.Attempts)
+	}
+
+	var attempts []model.DeliveryAttempt
+	if status := env.admin(t, http.MethodGet, "/subscriptions/sub_1/deliveries", nil, &attempts); status != http.StatusOK {
+		t.Fatalf("list status = %d, want %d", status, http.StatusOK)
+	}
+	if len(attempts) != 2 {
+		t.Fatalf("got %d attempts, want 2", len(attempts))
+	}
+	// Most recent first
+	if attempts[0].DeliveryId != redelivered.Id || attempts[0].StatusCode != http.StatusOK {
+		t.Errorf("latest attempt = %+v, want the redelivery succeeding", attempts[0])
+	}
+	if attempts[1].DeliveryId != original.Id || attempts[1].StatusCode != http.StatusBadGateway || attempts[1].Error == "" {
+		t.Errorf("first attempt = %+v, want the original failing", attempts[1])
+	}
+	if attempts[0].BodyHash != attempts[1].BodyHash || attempts[0].BodyHash == "" {
+		t.Errorf("body hashes %q and %q differ, want the same payload", attempts[0].BodyHash, attempts[1].BodyHash)
+	}
+
+	if status := env.admin(t, http.MethodGet, "/subscriptions/sub_1/deliveries?limit=1", nil, &attempts); status != http.StatusOK || len(attempts) != 1 {
+		t.Errorf("limit=1 returned %d with %d attempts, want 200 with 1", status, len(attempts))
+	}
+
+	for _, req := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/subscriptions/sub_1/deliveries?limit=0", http.StatusBadRequest},
+		{http.MethodGet, "/subscriptions/missing/deliveries", http.StatusNotFound},
+		{http.MethodPost, "/subscriptions/sub_1/deliveries/evt_2/redeliver", http.StatusNotFound},
+		{http.MethodPost, "/subscriptions/missing/deliveries/evt_1/redeliver", http.StatusNotFound},
+	} {
+		if status := env.admin(t, req.method, req.path, nil, nil); status != req.want {
+			t.Errorf("%s %s = %d, want %d", req.method, req.path, status, req.want)
+		}
+	}
+}
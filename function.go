@@ -3,45 +3,119 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"sync"
+	"time"
 
-	"cloud.google.com/go/pubsub"
 	"github.com/go-chi/chi"
-	"github.com/google/uuid"
 
 	"github.com/baely/balance/internal/database"
+	"github.com/baely/balance/internal/delivery"
 	"github.com/baely/balance/internal/integrations"
+	"github.com/baely/balance/internal/metrics"
 	"github.com/baely/balance/internal/service"
 	"github.com/baely/balance/pkg/model"
+	"github.com/baely/balance/pkg/up"
 )
 
 type Server struct {
 	http.Server
+
+	store      database.Store
+	bus        integrations.Bus
+	dispatcher *delivery.Dispatcher
+	up         *up.Client
+	upCache    *integrations.UpCache
+
+	// balanceAccountId is the account served by /account-balance
+	balanceAccountId string
+
+	// dedupTTL is how long processed event IDs are remembered
+	dedupTTL time.Duration
+
+	// cloudEventsSource is the source of CloudEvents sent to subscribers
+	cloudEventsSource string
+
+	// adminToken guards the subscription API
+	adminToken string
 }
 
-func newServer() *Server {
+func newServer(store database.Store, bus integrations.Bus) *Server {
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
-	r := chi.NewRouter()
+	dedupTTL, err := time.ParseDuration(os.Getenv("EVENT_DEDUP_TTL"))
+	if err != nil {
+		dedupTTL = 72 * time.Hour
+	}
+
+	cloudEventsSource := os.Getenv("CLOUDEVENTS_SOURCE")
+	if cloudEventsSource == "" {
+		cloudEventsSource = "/balance"
+	}
 
-	r.HandleFunc("/account-balance", RetrieveAccountBalance)
-	r.HandleFunc("/webhook", TriggerBalanceUpdate)
-	r.HandleFunc("/register", RegisterWebhook)
-	r.HandleFunc("/process", ProcessTransaction)
+	var upOptions []up.Option
+	if upApiUrl := os.Getenv("UP_API_URL"); upApiUrl != "" {
+		upOptions = append(upOptions, up.WithBaseURL(upApiUrl))
+	}
+	upClient := up.NewClient(os.Getenv("UP_TOKEN"), upOptions...)
 
-	return &Server{
-		http.Server{
-			Addr:    fmt.Sprintf(":%s", port),
-			Handler: r,
+	s := &Server{
+		Server: http.Server{
+			Addr: fmt.Sprintf(":%s", port),
 		},
+		store:             store,
+		bus:               bus,
+		dispatcher:        delivery.NewDispatcher(store, delivery.PolicyFromEnv(), delivery.LimitsFromEnv()),
+		up:                upClient,
+		upCache:           integrations.NewUpCache(upClient),
+		balanceAccountId:  os.Getenv("BALANCE_ACCOUNT_ID"),
+		dedupTTL:          dedupTTL,
+		cloudEventsSource: cloudEventsSource,
+		adminToken:        os.Getenv("ADMIN_TOKEN"),
 	}
+
+	if s.adminToken == "" {
+		fmt.Println("ADMIN_TOKEN is not set, the admin API is disabled")
+	}
+
+	r := chi.NewRouter()
+
+	r.HandleFunc("/account-balance", s.RetrieveAccountBalance)
+	r.HandleFunc("/webhook", s.TriggerBalanceUpdate)
+	r.HandleFunc("/process", s.ProcessTransaction)
+
+	r.Group(func(r chi.Router) {
+		r.Use(s.requireAdmin)
+
+		r.Handle("/debug/vars", expvar.Handler())
+		r.Post("/register", s.RegisterWebhook)
+		r.Get("/accounts", s.ListAccounts)
+		r.Get("/accounts/{accountId}/balance", s.GetBalanceAt)
+		r.Get("/accounts/{accountId}/history", s.GetBalanceHistory)
+		r.Get("/dead-letters", s.ListDeadLetters)
+		r.Get("/dead-letters/{deliveryId}", s.GetDeadLetter)
+		r.Post("/dead-letters/{deliveryId}/redrive", s.RedriveDeadLetter)
+		r.Post("/deliveries/retry", s.RetryDeliveries)
+		r.Get("/subscriptions", s.ListSubscriptions)
+		r.Post("/subscriptions", s.CreateSubscription)
+		r.Get("/subscriptions/{subscriptionId}", s.GetSubscription)
+		r.Patch("/subscriptions/{subscriptionId}", s.UpdateSubscription)
+		r.Delete("/subscriptions/{subscriptionId}", s.DeleteSubscription)
+		r.Post("/subscriptions/{subscriptionId}/secret", s.RotateSubscriptionSecret)
+		r.Get("/subscriptions/{subscriptionId}/deliveries", s.ListSubscriptionDeliveries)
+		r.Post("/subscriptions/{subscriptionId}/deliveries/{eventId}/redeliver", s.RedeliverEvent)
+	})
+
+	s.Handler = r
+
+	return s
 }
 
 func (s *Server) Start() error {
@@ -49,29 +123,65 @@ func (s *Server) Start() error {
 	return s.ListenAndServe()
 }
 
-func RetrieveAccountBalance(w http.ResponseWriter, r *http.Request) {
-	// Retrieve current account balance from firestore
-	dbClient, err := database.GetClient(os.Getenv("GCP_PROJECT"))
+func (s *Server) RetrieveAccountBalance(w http.ResponseWriter, r *http.Request) {
+	// Retrieve current account balance from the store
+	accountBalance, err := s.balanceAccount()
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		fmt.Println(err)
 		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	// Write account balance to response
+	io.WriteString(w, accountBalance.Balance)
+}
+
+// balanceAccount returns the account served by /account-balance. This is
+// BALANCE_ACCOUNT_ID when set, otherwise the first individual transactional
+// account. Joint accounts are only used when there is no individual one.
+func (s *Server) balanceAccount() (model.AccountBalance, error) {
+	if s.balanceAccountId != "" {
+		return s.store.GetAccountBalance(s.balanceAccountId)
 	}
-	defer dbClient.Close()
 
-	accountBalance, err := dbClient.GetAccountBalance()
+	balances, err := s.store.ListAccountBalances()
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, "", http.StatusInternalServerError)
+		return model.AccountBalance{}, err
 	}
 
-	// Write account balance to response
-	io.WriteString(w, accountBalance)
+	var joint *model.AccountBalance
+	for i, balance := range balances {
+		if balance.AccountType != "TRANSACTIONAL" {
+			continue
+		}
+		if balance.OwnershipType == "INDIVIDUAL" {
+			return balance, nil
+		}
+		if joint == nil {
+			joint = &balances[i]
+		}
+	}
+
+	if joint != nil {
+		return *joint, nil
+	}
+
+	return model.AccountBalance{}, database.ErrNotFound
 }
 
-func TriggerBalanceUpdate(w http.ResponseWriter, r *http.Request) {
-	client := integrations.GetClient()
-	defer client.Close()
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Println("encode error:", err)
+	}
+}
 
+func (s *Server) TriggerBalanceUpdate(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		fmt.Println("read error:", err)
@@ -88,19 +198,8 @@ func TriggerBalanceUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	topic := client.Topic("webhook-events")
-
-	guid, _ := uuid.NewRandom()
-
-	msg := &pubsub.Message{
-		ID:   guid.String(),
-		Data: body,
-	}
-
-	// Push event to pubsub topic
-	ctx := context.Background()
-	res := topic.Publish(ctx, msg)
-	_, err = res.Get(ctx)
+	// Push event to the webhook events topic
+	_, err = s.bus.Publish(r.Context(), integrations.WebhookEventsTopic, body)
 	if err != nil {
 		fmt.Println("publish error:", err)
 		http.Error(w, "", http.StatusInternalServerError)
@@ -131,7 +230,7 @@ func unmarshall[T any](r io.Reader, v T) error {
 	return json.Unmarshal(e.Message.Data, &v)
 }
 
-func ProcessTransaction(w http.ResponseWriter, r *http.Request) {
+func (s *Server) ProcessTransaction(w http.ResponseWriter, r *http.Request) {
 	var upEvent model.WebhookEventCallback
 	err := unmarshall(r.Body, &upEvent)
 	if err != nil {
@@ -140,84 +239,171 @@ func ProcessTransaction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	upClient := integrations.NewUpClient(os.Getenv("UP_TOKEN"))
+	if err := s.processEvent(r.Context(), upEvent); err != nil {
+		// Pub/Sub redelivers anything but a success, so only ask for
+		// errors that may go away
+		if permanent(err) {
+			fmt.Println("dropping event that cannot be processed:", upEvent.Data.Id)
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+}
 
+func (s *Server) processEvent(ctx context.Context, upEvent model.WebhookEventCallback) error {
 	// Retrieve transaction details
 	eventTransaction := upEvent.Data.Relationships.Transaction
 
 	if eventTransaction == nil {
 		fmt.Println("no transaction details")
-		return
+		return nil
 	}
-	transaction, err := upClient.GetTransaction(eventTransaction.Data.Id)
+	transaction, err := s.up.GetTransaction(ctx, eventTransaction.Data.Id)
 	if err != nil {
 		fmt.Println("error retrieving transaction:", err)
-		http.Error(w, "", http.StatusInternalServerError)
-		return
+		return err
 	}
 
-	// Retrieve account details
+	// Retrieve account details, which carry the live balance
 	accountId := transaction.Relationships.Account.Data.Id
-	account, err := upClient.GetAccount(accountId)
+	account, err := s.up.GetAccount(ctx, accountId)
 	if err != nil {
 		fmt.Println("error retrieving account:", err)
-		http.Error(w, "", http.StatusInternalServerError)
-		return
+		return err
 	}
 
-	accountBalance := account.Attributes.Balance.Value
+	// The balance is Up's at the time of the fetch, not of the event, so it
+	// is stamped with the fetch time
+	accountBalance := model.NewAccountBalance(account, time.Now())
+
+	// Update datastore. A balance fetched earlier but written later, such as
+	// by a slower concurrent event, must not overwrite the newer balance.
+	err = s.store.UpdateAccountBalance(accountBalance)
+	stale := errors.Is(err, database.ErrStaleWrite)
+	if stale {
+		fmt.Println("skipping stale balance update. account:", accountId, "event:", upEvent.Data.Id)
+		metrics.StaleBalanceWrites.Add(1)
+	} else if err != nil {
+		fmt.Println("database error:", err)
+		return err
+	}
+
+	// History is keyed by transaction and timestamped with its creation, so
+	// only the event that creates a transaction records it. A later event,
+	// such as a settlement days after, would put today's balance at that time.
+	// A stale write likewise holds a balance that is already superseded.
+	if !stale && fmt.Sprint(upEvent.Data.Attributes.EventType) == "TRANSACTION_CREATED" {
+		if err := s.store.AddBalanceSnapshot(model.NewBalanceSnapshot(account, transaction)); err != nil {
+			fmt.Println("database error:", err)
+			return err
+		}
+	}
 
-	// Update datastore
-	dbClient, err := database.GetClient(os.Getenv("GCP_PROJECT"))
+	// Up retries deliveries and the bus is at-least-once, so only notify
+	// subscribers the first time an event is seen
+	claimed, err := s.store.ClaimEvent(upEvent.Data.Id, s.dedupTTL)
 	if err != nil {
 		fmt.Println("database error:", err)
-		http.Error(w, "", http.StatusInternalServerError)
-		return
+		return err
+	}
+	if !claimed {
+		fmt.Println("skipping duplicate event:", upEvent.Data.Id)
+		metrics.DuplicateEvents.Add(1)
+		return nil
+	}
+
+	// Release the claim if subscribers could not be notified, so that the
+	// redelivered event is not skipped as a duplicate
+	if err := s.notify(ctx, upEvent, account, transaction); err != nil {
+		if err := s.store.ReleaseEvent(upEvent.Data.Id); err != nil {
+			fmt.Println("database error:", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// notify delivers an event to every matching subscriber and publishes it to
+// the transactions topic. Subscribers that already have a delivery of the
+// event, from an earlier attempt that failed part way, are skipped.
+func (s *Server) notify(ctx context.Context, upEvent model.WebhookEventCallback, account model.AccountResource, transaction model.TransactionResource) error {
+	subscriptions, err := s.store.ListSubscriptions("")
+	if err != nil {
+		fmt.Println("database error:", err)
+		return err
+	}
+
+	// Build each type of payload once for every subscriber. Summaries are only
+	// built for debits.
+	payloads := make(map[model.SubscriptionType][]byte)
+
+	summaryPayload, ok, err := service.WebhookEventPayload(account, transaction)
+	if err != nil {
+		fmt.Println("error building webhook:", err)
+	} else if ok {
+		payloads[model.SubscriptionSummary] = summaryPayload
+	}
+
+	rawPayload, err := service.RawWebhookEventPayload(account, transaction)
+	if err != nil {
+		fmt.Println("error building raw webhook:", err)
+	} else {
+		payloads[model.SubscriptionRaw] = rawPayload
+	}
+
+	event := service.EventData{
+		EventId:        upEvent.Data.Id,
+		EventType:      fmt.Sprint(upEvent.Data.Attributes.EventType),
+		EventCreatedAt: upEvent.Data.Attributes.CreatedAt,
+		Account:        account,
+		Transaction:    transaction,
+	}
+
+	if category := transaction.Relationships.Category.Data; category != nil {
+		event.Category = s.lookupCategory(ctx, category.Id)
+	}
+	if parent := transaction.Relationships.ParentCategory.Data; parent != nil {
+		event.ParentCategory = s.lookupCategory(ctx, parent.Id)
 	}
-	defer dbClient.Close()
 
-	dbClient.UpdateAccountBalance(accountBalance)
+	var targets []delivery.Target
+	for _, subscription := range enabledSubscriptions(subscriptions) {
+		if !service.MatchFilter(service.SubscriptionFilter(subscription), event.EventType, account, transaction) {
+			continue
+		}
 
-	webhookUris, _ := dbClient.GetWebhookUris()
-	rawWebhookUris, _ := dbClient.GetRawWebhookUris()
+		_, err := s.store.GetEventDelivery(subscription.Id, upEvent.Data.Id)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, database.ErrNotFound) {
+			fmt.Println("database error:", err)
+			return err
+		}
 
-	wg := &sync.WaitGroup{}
-	fmt.Println("sending webhook events. count:", len(webhookUris))
-	for _, uri := range webhookUris {
-		if upEvent.Data.Attributes.EventType != model.WebhookEventTypeEnum("TRANSACTION_CREATED") {
-			// Skip sending webhook events for non-transaction created events
-			break
+		payload, ok, err := s.subscriptionPayload(subscription, event, payloads)
+		if err != nil {
+			fmt.Println("error building payload for subscription:", subscription.Id, err)
+			continue
 		}
-		if account.Attributes.AccountType != model.AccountTypeEnum("TRANSACTIONAL") {
-			// Skip sending webhook events for non-transactional accounts
-			break
+		if !ok {
+			continue
 		}
 
-		wg.Add(1)
-		go func(uri string) {
-			fmt.Println("sending webhook to:", uri)
-			if err := service.SendWebhookEvent(uri, account, transaction); err != nil {
-				fmt.Println("error sending webhook:", err)
-			}
-			wg.Done()
-		}(uri)
+		fmt.Println("sending", subscription.Type, "webhook to:", subscription.Uri)
+		targets = append(targets, delivery.Target{Subscription: subscription, Payload: payload})
 	}
 
-	fmt.Println("sending raw webhook events. count:", len(rawWebhookUris))
-	for _, uri := range rawWebhookUris {
-		wg.Add(1)
-		go func(uri string) {
-			fmt.Println("sending raw webhook to:", uri)
-			if err := service.SendRawWebhookEvent(uri, account, transaction); err != nil {
-				fmt.Println("error sending raw webhook:", err)
-			}
-			wg.Done()
-		}(uri)
+	// First attempts are made before the event is acknowledged, while the
+	// request still has CPU, for as long as DELIVERY_FIRST_ATTEMPT_WAIT allows
+	if err := s.dispatcher.Deliver(ctx, upEvent.Data.Id, targets); err != nil {
+		fmt.Println("error sending webhook:", err)
+		return err
 	}
 
-	wg.Wait()
-
-	// push the message to pubsub
+	// push the message to the transactions topic
 	type TransactionEvent struct {
 		Account     model.AccountResource
 		Transaction model.TransactionResource
@@ -228,45 +414,25 @@ func ProcessTransaction(w http.ResponseWriter, r *http.Request) {
 		Transaction: transaction,
 	})
 
-	client := integrations.GetClient()
-	topic := client.Topic("transactions")
-	res := topic.Publish(context.Background(), &pubsub.Message{
-		ID:   uuid.NewString(),
-		Data: data,
-	})
-	id, err := res.Get(context.Background())
+	id, err := s.bus.Publish(ctx, integrations.TransactionsTopic, data)
 	if err != nil {
 		fmt.Println("error publishing message:", err)
-	} else {
-		fmt.Println("new published message:", id)
+		return err
 	}
+	fmt.Println("new published message:", id)
 
-	return
+	return nil
 }
 
-func RegisterWebhook(w http.ResponseWriter, r *http.Request) {
-	data, err := io.ReadAll(r.Body)
-	if err != nil {
-		fmt.Println("data error:", err)
-		http.Error(w, "", http.StatusInternalServerError)
-	}
-
-	// Get URI from request
-	uri := string(data)
-
-	dbClient, err := database.GetClient(os.Getenv("GCP_PROJECT"))
+// lookupCategory returns a category, or nil if it cannot be found. Category
+// names are only used by templates, so a failed lookup does not stop the
+// event.
+func (s *Server) lookupCategory(ctx context.Context, categoryId string) *model.CategoryResource {
+	category, err := s.upCache.Category(ctx, categoryId)
 	if err != nil {
-		fmt.Println("database error:", err)
-		http.Error(w, "", http.StatusInternalServerError)
-	}
-	defer dbClient.Close()
-
-	// Add new URI to firestore
-	err = dbClient.AddWebhook(uri)
-	if err != nil {
-		fmt.Println("database write error:", err)
-		http.Error(w, "", http.StatusInternalServerError)
+		fmt.Println("error retrieving category:", err)
+		return nil
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	return &category
 }
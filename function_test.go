@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/baely/balance/internal/integrations"
+	"github.com/baely/balance/pkg/model"
+	"github.com/baely/balance/pkg/up/uptest"
+	"github.com/baely/balance/pkg/webhook"
+)
+
+// subscribe registers a summary subscriber and returns the deliveries it
+// receives.
+func (e *testEnv) subscribe(t *testing.T) <-chan []byte {
+	t.Helper()
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries := make(chan []byte, 10)
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify(secret, r.Header, body); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		deliveries <- body
+	}))
+	t.Cleanup(subscriber.Close)
+
+	err = e.store.AddSubscription(model.Subscription{
+		Id:      "sub_1",
+		Type:    model.SubscriptionSummary,
+		Uri:     subscriber.URL,
+		Secret:  secret,
+		Enabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return deliveries
+}
+
+// process pushes an event to /process as Pub/Sub would.
+func (e *testEnv) process(t *testing.T, event model.WebhookEventCallback) int {
+	t.Helper()
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(MessagePublishedData{Message: PubSubMessage{Data: data}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Post(e.service.URL+"/process", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+// newEvent returns an Up webhook event about a transaction.
+func newEvent(t *testing.T, id, eventType, transactionId string) model.WebhookEventCallback {
+	t.Helper()
+
+	var event model.WebhookEventCallback
+	err := json.Unmarshal([]byte(`{
+		"data": {
+			"type": "webhook-events",
+			"id": "`+id+`",
+			"attributes": {"eventType": "`+eventType+`", "createdAt": "`+time.Now().Format(time.RFC3339)+`"},
+			"relationships": {
+				"webhook": {"data": {"type": "webhooks", "id": "webhook_1"}},
+				"transaction": {"data": {"type": "transactions", "id": "`+transactionId+`"}}
+			}
+		}
+	}`), &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return event
+}
+
+// addDebit adds a debit of cents to the spending account of the fake.
+func addDebit(t *testing.T, fake *uptest.Server, cents int) model.TransactionResource {
+	t.Helper()
+
+	transaction := uptest.DefaultFixtures().Transactions[0]
+	transaction.Id = ""
+	transaction.Attributes.CreatedAt = time.Time{}
+	transaction.Attributes.Amount.ValueInBaseUnits = -cents
+
+	transaction, err := fake.AddTransaction(transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return transaction
+}
+
+func TestProcessEvent(t *testing.T) {
+	env := newTestEnv(t)
+	deliveries := env.subscribe(t)
+
+	transaction := addDebit(t, env.fake, 1056)
+	event := newEvent(t, "evt_1", "TRANSACTION_CREATED", transaction.Id)
+
+	if status := env.process(t, event); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+
+	// The first attempt is made before /process responds
+	select {
+	case body := <-deliveries:
+		if !bytes.Contains(body, []byte("1224.00")) {
+			t.Errorf("summary %s does not carry the new balance", body)
+		}
+	default:
+		t.Fatal("subscriber was not sent the event")
+	}
+
+	balance, err := env.store.GetAccountBalance(spendingAccountId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Balance != "1224.00" {
+		t.Errorf("balance = %s, want 1224.00", balance.Balance)
+	}
+
+	snapshot, err := env.store.GetBalanceAt(spendingAccountId, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.TransactionId != transaction.Id {
+		t.Errorf("snapshot of transaction %s, want %s", snapshot.TransactionId, transaction.Id)
+	}
+
+	// Redelivered events are not sent to subscribers again
+	if status := env.process(t, event); status != http.StatusOK {
+		t.Fatalf("status = %d on redelivery, want %d", status, http.StatusOK)
+	}
+	select {
+	case <-deliveries:
+		t.Error("subscriber was sent a redelivered event")
+	default:
+	}
+}
+
+func TestProcessEventSettledKeepsHistory(t *testing.T) {
+	env := newTestEnv(t)
+
+	transaction := addDebit(t, env.fake, 500)
+	if status := env.process(t, newEvent(t, "evt_1", "TRANSACTION_CREATED", transaction.Id)); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+
+	// A later transaction moves the balance before the first one settles
+	addDebit(t, env.fake, 1000)
+	if status := env.process(t, newEvent(t, "evt_2", "TRANSACTION_SETTLED", transaction.Id)); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+
+	snapshots, err := env.store.ListBalanceSnapshots(spendingAccountId, time.Time{}, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Balance != "1229.56" {
+		t.Errorf("snapshots = %+v, want one at 1229.56", snapshots)
+	}
+}
+
+func TestProcessEventErrors(t *testing.T) {
+	env := newTestEnv(t)
+
+	// Up no longer has the transaction, so redelivering will not help
+	if status := env.process(t, newEvent(t, "evt_1", "TRANSACTION_DELETED", "missing")); status != http.StatusOK {
+		t.Errorf("status = %d for a missing transaction, want %d", status, http.StatusOK)
+	}
+
+	// Up being down is worth a redelivery
+	transaction := addDebit(t, env.fake, 500)
+	env.fake.Inject(uptest.Fault{Path: "transactions/*", Status: http.StatusServiceUnavailable})
+	if status := env.process(t, newEvent(t, "evt_2", "TRANSACTION_CREATED", transaction.Id)); status != http.StatusInternalServerError {
+		t.Errorf("status = %d while Up is down, want %d", status, http.StatusInternalServerError)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	env := newTestEnv(t)
+	deliveries := env.subscribe(t)
+
+	// Events reaching /webhook are processed in-process from the memory bus
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msgs, err := env.server.bus.Subscribe(ctx, integrations.WebhookEventsTopic, "process")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go env.server.consume(ctx, msgs, "process", 1)
+
+	env.fake.AddWebhook(env.service.URL+"/webhook", "up-secret")
+	transaction := addDebit(t, env.fake, 1056)
+	if err := env.fake.Emit(context.Background(), "TRANSACTION_CREATED", transaction.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-deliveries:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscriber was not sent the event")
+	}
+
+	// Events signed with another secret are rejected
+	env.fake.AddWebhook(env.service.URL+"/webhook", "wrong-secret")
+	if err := env.fake.Emit(context.Background(), "TRANSACTION_CREATED", transaction.Id); err == nil {
+		t.Error("Emit() succeeded with a webhook signed by the wrong secret")
+	}
+}
@@ -3,17 +3,29 @@ package database
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	firebase "firebase.google.com/go"
 	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/baely/balance/pkg/model"
 )
 
-type Client struct {
+func init() {
+	Register("firestore", func(dsn string) (Store, error) {
+		return NewFirestoreClient(dsn)
+	})
+}
+
+// FirestoreClient is the Firestore backed Store.
+type FirestoreClient struct {
 	firestoreClient *firestore.Client
 }
 
-func GetClient(projectId string) (*Client, error) {
+func NewFirestoreClient(projectId string) (*FirestoreClient, error) {
 	ctx := context.Background()
 	firebaseCfg := &firebase.Config{
 		ProjectID: projectId,
@@ -28,19 +40,145 @@ func GetClient(projectId string) (*Client, error) {
 		return nil, err
 	}
 
-	return &Client{
+	return &FirestoreClient{
 		client,
 	}, nil
 }
 
-func (c *Client) Close() {
+func (c *FirestoreClient) Close() {
 	c.firestoreClient.Close()
 }
 
-func (c *Client) UpdateAccountBalance(value string) error {
+type accountDoc struct {
+	DisplayName   string    `firestore:"display_name"`
+	AccountType   string    `firestore:"account_type"`
+	OwnershipType string    `firestore:"ownership_type"`
+	Balance       string    `firestore:"balance"`
+	CurrencyCode  string    `firestore:"currency_code"`
+	UpdatedAt     time.Time `firestore:"updated_at"`
+	AsOf          time.Time `firestore:"as_of"`
+}
+
+func (d accountDoc) toModel(accountId string) model.AccountBalance {
+	return model.AccountBalance{
+		AccountId:     accountId,
+		DisplayName:   d.DisplayName,
+		AccountType:   d.AccountType,
+		OwnershipType: d.OwnershipType,
+		Balance:       d.Balance,
+		CurrencyCode:  d.CurrencyCode,
+		UpdatedAt:     d.UpdatedAt,
+		AsOf:          d.AsOf,
+	}
+}
+
+func (c *FirestoreClient) UpdateAccountBalance(balance model.AccountBalance) error {
+	ctx := context.Background()
+	ref := c.firestoreClient.Collection("accounts").Doc(balance.AccountId)
+
+	return c.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		if doc != nil && doc.Exists() {
+			var current accountDoc
+			if err := doc.DataTo(&current); err != nil {
+				return err
+			}
+			if current.AsOf.After(balance.AsOf) {
+				return ErrStaleWrite
+			}
+		}
+
+		return tx.Set(ref, accountDoc{
+			DisplayName:   balance.DisplayName,
+			AccountType:   balance.AccountType,
+			OwnershipType: balance.OwnershipType,
+			Balance:       balance.Balance,
+			CurrencyCode:  balance.CurrencyCode,
+			UpdatedAt:     balance.UpdatedAt,
+			AsOf:          balance.AsOf,
+		})
+	})
+}
+
+func (c *FirestoreClient) GetAccountBalance(accountId string) (model.AccountBalance, error) {
+	ctx := context.Background()
+	doc, err := c.firestoreClient.Collection("accounts").Doc(accountId).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return model.AccountBalance{}, ErrNotFound
+	}
+	if err != nil {
+		return model.AccountBalance{}, err
+	}
+
+	var d accountDoc
+	if err := doc.DataTo(&d); err != nil {
+		return model.AccountBalance{}, err
+	}
+
+	return d.toModel(doc.Ref.ID), nil
+}
+
+func (c *FirestoreClient) ListAccountBalances() ([]model.AccountBalance, error) {
+	var balances []model.AccountBalance
+
+	ctx := context.Background()
+	iter := c.firestoreClient.Collection("accounts").OrderBy("display_name", firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var d accountDoc
+		if err := doc.DataTo(&d); err != nil {
+			fmt.Println("error parsing account:", err)
+			continue
+		}
+
+		balances = append(balances, d.toModel(doc.Ref.ID))
+	}
+
+	return balances, nil
+}
+
+type snapshotDoc struct {
+	Balance          string    `firestore:"balance"`
+	ValueInBaseUnits int       `firestore:"value_in_base_units"`
+	CurrencyCode     string    `firestore:"currency_code"`
+	CreatedAt        time.Time `firestore:"created_at"`
+}
+
+func (d snapshotDoc) toModel(accountId, transactionId string) model.BalanceSnapshot {
+	return model.BalanceSnapshot{
+		AccountId:        accountId,
+		TransactionId:    transactionId,
+		Balance:          d.Balance,
+		ValueInBaseUnits: d.ValueInBaseUnits,
+		CurrencyCode:     d.CurrencyCode,
+		CreatedAt:        d.CreatedAt,
+	}
+}
+
+func (c *FirestoreClient) history(accountId string) *firestore.CollectionRef {
+	return c.firestoreClient.Collection("accounts").Doc(accountId).Collection("history")
+}
+
+func (c *FirestoreClient) AddBalanceSnapshot(snapshot model.BalanceSnapshot) error {
 	ctx := context.Background()
-	_, err := c.firestoreClient.Collection("balance").Doc("account-balance").Set(ctx, map[string]interface{}{
-		"balance": value,
+	_, err := c.history(snapshot.AccountId).Doc(snapshot.TransactionId).Set(ctx, snapshotDoc{
+		Balance:          snapshot.Balance,
+		ValueInBaseUnits: snapshot.ValueInBaseUnits,
+		CurrencyCode:     snapshot.CurrencyCode,
+		CreatedAt:        snapshot.CreatedAt,
 	})
 	if err != nil {
 		return err
@@ -49,34 +187,451 @@ func (c *Client) UpdateAccountBalance(value string) error {
 	return nil
 }
 
-func (c *Client) GetAccountBalance() (string, error) {
+func (c *FirestoreClient) GetBalanceAt(accountId string, at time.Time) (model.BalanceSnapshot, error) {
 	ctx := context.Background()
-	iter, err := c.firestoreClient.Collection("balance").Doc("account-balance").Get(ctx)
+	docs, err := c.history(accountId).
+		Where("created_at", "<=", at).
+		OrderBy("created_at", firestore.Desc).
+		Limit(1).
+		Documents(ctx).
+		GetAll()
 	if err != nil {
-		fmt.Println(err)
-		return "", err
+		return model.BalanceSnapshot{}, err
+	}
+
+	if len(docs) == 0 {
+		return model.BalanceSnapshot{}, ErrNotFound
+	}
+
+	var d snapshotDoc
+	if err := docs[0].DataTo(&d); err != nil {
+		return model.BalanceSnapshot{}, err
+	}
+
+	return d.toModel(accountId, docs[0].Ref.ID), nil
+}
+
+func (c *FirestoreClient) ListBalanceSnapshots(accountId string, from, to time.Time) ([]model.BalanceSnapshot, error) {
+	var snapshots []model.BalanceSnapshot
+
+	ctx := context.Background()
+	iter := c.history(accountId).
+		Where("created_at", ">=", from).
+		Where("created_at", "<", to).
+		OrderBy("created_at", firestore.Asc).
+		Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var d snapshotDoc
+		if err := doc.DataTo(&d); err != nil {
+			fmt.Println("error parsing balance snapshot:", err)
+			continue
+		}
+
+		snapshots = append(snapshots, d.toModel(accountId, doc.Ref.ID))
 	}
 
-	data, err := iter.DataAt("balance")
+	return snapshots, nil
+}
+
+// ClaimEvent stores claimed events in the processed-events collection.
+// Expired documents are ignored, and can be removed by a TTL policy on the
+// expires_at field.
+func (c *FirestoreClient) ClaimEvent(eventId string, ttl time.Duration) (bool, error) {
+	ctx := context.Background()
+	ref := c.firestoreClient.Collection("processed-events").Doc(eventId)
+
+	claimed := false
+	err := c.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		claimed = false
+
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		now := time.Now()
+		if doc != nil && doc.Exists() {
+			expiresAt, err := doc.DataAt("expires_at")
+			if err != nil {
+				return err
+			}
+			if t, ok := expiresAt.(time.Time); ok && t.After(now) {
+				return nil
+			}
+		}
+
+		claimed = true
+		return tx.Set(ref, map[string]interface{}{
+			"expires_at": now.Add(ttl),
+		})
+	})
 	if err != nil {
-		fmt.Println(err)
-		return "", err
+		return false, err
 	}
 
-	balance, ok := data.(string)
-	if !ok {
-		return "", fmt.Errorf("casting of data failed. data: %v", data)
+	return claimed, nil
+}
+
+func (c *FirestoreClient) ReleaseEvent(eventId string) error {
+	ctx := context.Background()
+	_, err := c.firestoreClient.Collection("processed-events").Doc(eventId).Delete(ctx)
+	return err
+}
+
+type deliveryDoc struct {
+	EventId        string            `firestore:"event_id"`
+	SubscriptionId string            `firestore:"subscription_id"`
+	Uri            string            `firestore:"uri"`
+	ContentType    string            `firestore:"content_type"`
+	Payload        []byte            `firestore:"payload"`
+	Status         string            `firestore:"status"`
+	Attempts       int               `firestore:"attempts"`
+	NextAttemptAt  time.Time         `firestore:"next_attempt_at"`
+	LastError      string            `firestore:"last_error"`
+	CreatedAt      time.Time         `firestore:"created_at"`
+	UpdatedAt      time.Time         `firestore:"updated_at"`
+	Headers        map[string]string `firestore:"headers"`
+}
+
+func newDeliveryDoc(delivery model.Delivery) deliveryDoc {
+	return deliveryDoc{
+		EventId:        delivery.EventId,
+		SubscriptionId: delivery.SubscriptionId,
+		Uri:            delivery.Uri,
+		ContentType:    delivery.ContentType,
+		Payload:        []byte(delivery.Payload),
+		Status:         string(delivery.Status),
+		Attempts:       delivery.Attempts,
+		NextAttemptAt:  delivery.NextAttemptAt,
+		LastError:      delivery.LastError,
+		CreatedAt:      delivery.CreatedAt,
+		UpdatedAt:      delivery.UpdatedAt,
+		Headers:        delivery.Headers,
 	}
+}
 
-	return balance, nil
+func (d deliveryDoc) toModel(id string) model.Delivery {
+	return model.Delivery{
+		Id:             id,
+		EventId:        d.EventId,
+		SubscriptionId: d.SubscriptionId,
+		Uri:            d.Uri,
+		ContentType:    d.ContentType,
+		Payload:        string(d.Payload),
+		Status:         model.DeliveryStatus(d.Status),
+		Attempts:       d.Attempts,
+		NextAttemptAt:  d.NextAttemptAt,
+		LastError:      d.LastError,
+		CreatedAt:      d.CreatedAt,
+		UpdatedAt:      d.UpdatedAt,
+		Headers:        d.Headers,
+	}
 }
 
-func (c *Client) AddWebhook(uri string) error {
+func toDeliveries(docs []*firestore.DocumentSnapshot) ([]model.Delivery, error) {
+	var deliveries []model.Delivery
+	for _, doc := range docs {
+		var d deliveryDoc
+		if err := doc.DataTo(&d); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d.toModel(doc.Ref.ID))
+	}
+
+	return deliveries, nil
+}
+
+func (c *FirestoreClient) CreateDelivery(delivery model.Delivery) error {
 	ctx := context.Background()
+	_, err := c.firestoreClient.Collection("deliveries").Doc(delivery.Id).Create(ctx, newDeliveryDoc(delivery))
+	if err != nil {
+		return err
+	}
 
-	_, _, err := c.firestoreClient.Collection("webhooks").Add(ctx, map[string]interface{}{
-		"uri": uri,
+	return nil
+}
+
+func (c *FirestoreClient) UpdateDelivery(delivery model.Delivery) error {
+	ctx := context.Background()
+	_, err := c.firestoreClient.Collection("deliveries").Doc(delivery.Id).Update(ctx, []firestore.Update{
+		{Path: "status", Value: string(delivery.Status)},
+		{Path: "attempts", Value: delivery.Attempts},
+		{Path: "next_attempt_at", Value: delivery.NextAttemptAt},
+		{Path: "last_error", Value: delivery.LastError},
+		{Path: "updated_at", Value: delivery.UpdatedAt},
 	})
+	if status.Code(err) == codes.NotFound {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+func (c *FirestoreClient) GetDelivery(id string) (model.Delivery, error) {
+	ctx := context.Background()
+	doc, err := c.firestoreClient.Collection("deliveries").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return model.Delivery{}, ErrNotFound
+	}
+	if err != nil {
+		return model.Delivery{}, err
+	}
+
+	var d deliveryDoc
+	if err := doc.DataTo(&d); err != nil {
+		return model.Delivery{}, err
+	}
+
+	return d.toModel(doc.Ref.ID), nil
+}
+
+func (c *FirestoreClient) ListDeliveries(deliveryStatus model.DeliveryStatus, limit int) ([]model.Delivery, error) {
+	ctx := context.Background()
+	docs, err := c.firestoreClient.Collection("deliveries").
+		Where("status", "==", string(deliveryStatus)).
+		OrderBy("created_at", firestore.Desc).
+		Limit(limit).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	return toDeliveries(docs)
+}
+
+func (c *FirestoreClient) LeaseDeliveries(now time.Time, lease time.Duration, limit int) ([]model.Delivery, error) {
+	var deliveries []model.Delivery
+
+	ctx := context.Background()
+	query := c.firestoreClient.Collection("deliveries").
+		Where("status", "==", string(model.DeliveryPending)).
+		Where("next_attempt_at", "<=", now).
+		OrderBy("next_attempt_at", firestore.Asc).
+		Limit(limit)
+
+	err := c.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docs, err := tx.Documents(query).GetAll()
+		if err != nil {
+			return err
+		}
+
+		deliveries, err = toDeliveries(docs)
+		if err != nil {
+			return err
+		}
+
+		for i, doc := range docs {
+			deliveries[i].NextAttemptAt = now.Add(lease)
+			err := tx.Update(doc.Ref, []firestore.Update{
+				{Path: "next_attempt_at", Value: deliveries[i].NextAttemptAt},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (c *FirestoreClient) GetEventDelivery(subscriptionId, eventId string) (model.Delivery, error) {
+	ctx := context.Background()
+	docs, err := c.firestoreClient.Collection("deliveries").
+		Where("subscription_id", "==", subscriptionId).
+		Where("event_id", "==", eventId).
+		OrderBy("created_at", firestore.Desc).
+		Limit(1).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return model.Delivery{}, err
+	}
+
+	deliveries, err := toDeliveries(docs)
+	if err != nil {
+		return model.Delivery{}, err
+	}
+	if len(deliveries) == 0 {
+		return model.Delivery{}, ErrNotFound
+	}
+
+	return deliveries[0], nil
+}
+
+type deliveryAttemptDoc struct {
+	DeliveryId     string    `firestore:"delivery_id"`
+	SubscriptionId string    `firestore:"subscription_id"`
+	EventId        string    `firestore:"event_id"`
+	Attempt        int       `firestore:"attempt"`
+	BodyHash       string    `firestore:"body_hash"`
+	StatusCode     int       `firestore:"status_code"`
+	LatencyMs      int64     `firestore:"latency_ms"`
+	Error          string    `firestore:"error"`
+	CreatedAt      time.Time `firestore:"created_at"`
+}
+
+func (c *FirestoreClient) AddDeliveryAttempt(attempt model.DeliveryAttempt) error {
+	ctx := context.Background()
+	_, err := c.firestoreClient.Collection("delivery-attempts").Doc(attempt.Id).Create(ctx, deliveryAttemptDoc{
+		DeliveryId:     attempt.DeliveryId,
+		SubscriptionId: attempt.SubscriptionId,
+		EventId:        attempt.EventId,
+		Attempt:        attempt.Attempt,
+		BodyHash:       attempt.BodyHash,
+		StatusCode:     attempt.StatusCode,
+		LatencyMs:      attempt.LatencyMs,
+		Error:          attempt.Error,
+		CreatedAt:      attempt.CreatedAt,
+	})
+	return err
+}
+
+func (c *FirestoreClient) ListDeliveryAttempts(subscriptionId string, limit int) ([]model.DeliveryAttempt, error) {
+	ctx := context.Background()
+	docs, err := c.firestoreClient.Collection("delivery-attempts").
+		Where("subscription_id", "==", subscriptionId).
+		OrderBy("created_at", firestore.Desc).
+		Limit(limit).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var attempts []model.DeliveryAttempt
+	for _, doc := range docs {
+		var d deliveryAttemptDoc
+		if err := doc.DataTo(&d); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, model.DeliveryAttempt{
+			Id:             doc.Ref.ID,
+			DeliveryId:     d.DeliveryId,
+			SubscriptionId: d.SubscriptionId,
+			EventId:        d.EventId,
+			Attempt:        d.Attempt,
+			BodyHash:       d.BodyHash,
+			StatusCode:     d.StatusCode,
+			LatencyMs:      d.LatencyMs,
+			Error:          d.Error,
+			CreatedAt:      d.CreatedAt,
+		})
+	}
+
+	return attempts, nil
+}
+
+// Subscriptions are stored in a collection per type.
+var subscriptionCollections = map[model.SubscriptionType]string{
+	model.SubscriptionSummary: "webhooks",
+	model.SubscriptionRaw:     "raw-webhooks",
+}
+
+// Disabled rather than enabled is stored so that subscriptions registered
+// before it existed stay enabled.
+type subscriptionDoc struct {
+	Uri         string    `firestore:"uri"`
+	Secret      string    `firestore:"secret"`
+	Description string    `firestore:"description"`
+	Disabled    bool      `firestore:"disabled"`
+	CreatedAt   time.Time `firestore:"created_at"`
+	UpdatedAt   time.Time `firestore:"updated_at"`
+	Filter      string    `firestore:"filter"`
+	Template    string    `firestore:"template"`
+	Format      string    `firestore:"format"`
+	Health      string    `firestore:"health"`
+}
+
+func newSubscriptionDoc(subscription model.Subscription) (subscriptionDoc, error) {
+	filter, err := encodeJSON(subscription.Filter)
+	if err != nil {
+		return subscriptionDoc{}, err
+	}
+	template, err := encodeJSON(subscription.Template)
+	if err != nil {
+		return subscriptionDoc{}, err
+	}
+	health, err := encodeJSON(&subscription.Health)
+	if err != nil {
+		return subscriptionDoc{}, err
+	}
+
+	return subscriptionDoc{
+		Uri:         subscription.Uri,
+		Secret:      subscription.Secret,
+		Description: subscription.Description,
+		Disabled:    !subscription.Enabled,
+		CreatedAt:   subscription.CreatedAt,
+		UpdatedAt:   subscription.UpdatedAt,
+		Filter:      filter,
+		Template:    template,
+		Format:      string(subscription.Format),
+		Health:      health,
+	}, nil
+}
+
+func (d subscriptionDoc) toModel(id string, subscriptionType model.SubscriptionType) (model.Subscription, error) {
+	filter, err := decodeJSON[model.SubscriptionFilter](d.Filter)
+	if err != nil {
+		return model.Subscription{}, err
+	}
+	template, err := decodeJSON[model.PayloadTemplate](d.Template)
+	if err != nil {
+		return model.Subscription{}, err
+	}
+	health, err := decodeJSON[model.SubscriptionHealth](d.Health)
+	if err != nil {
+		return model.Subscription{}, err
+	}
+	if health == nil {
+		health = &model.SubscriptionHealth{}
+	}
+
+	return model.Subscription{
+		Id:          id,
+		Type:        subscriptionType,
+		Uri:         d.Uri,
+		Secret:      d.Secret,
+		Description: d.Description,
+		Enabled:     !d.Disabled,
+		CreatedAt:   d.CreatedAt,
+		UpdatedAt:   d.UpdatedAt,
+		Filter:      filter,
+		Template:    template,
+		Format:      model.SubscriptionFormat(d.Format),
+		Health:      *health,
+	}, nil
+}
+
+func (c *FirestoreClient) AddSubscription(subscription model.Subscription) error {
+	collection, ok := subscriptionCollections[subscription.Type]
+	if !ok {
+		return fmt.Errorf("unknown subscription type: %q", subscription.Type)
+	}
+
+	d, err := newSubscriptionDoc(subscription)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	_, err = c.firestoreClient.Collection(collection).Doc(subscription.Id).Create(ctx, d)
 	if err != nil {
 		return err
 	}
@@ -84,11 +639,52 @@ func (c *Client) AddWebhook(uri string) error {
 	return nil
 }
 
-func (c *Client) getUris(path string) ([]string, error) {
-	var uris []string
+func (c *FirestoreClient) GetSubscription(id string) (model.Subscription, error) {
+	ctx := context.Background()
+
+	for subscriptionType, collection := range subscriptionCollections {
+		doc, err := c.firestoreClient.Collection(collection).Doc(id).Get(ctx)
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return model.Subscription{}, err
+		}
+
+		var d subscriptionDoc
+		if err := doc.DataTo(&d); err != nil {
+			return model.Subscription{}, err
+		}
+
+		return d.toModel(doc.Ref.ID, subscriptionType)
+	}
+
+	return model.Subscription{}, ErrNotFound
+}
+
+func (c *FirestoreClient) ListSubscriptions(subscriptionType model.SubscriptionType) ([]model.Subscription, error) {
+	if subscriptionType == "" {
+		var subscriptions []model.Subscription
+		for _, t := range []model.SubscriptionType{model.SubscriptionSummary, model.SubscriptionRaw} {
+			s, err := c.ListSubscriptions(t)
+			if err != nil {
+				return nil, err
+			}
+			subscriptions = append(subscriptions, s...)
+		}
+		return subscriptions, nil
+	}
+
+	collection, ok := subscriptionCollections[subscriptionType]
+	if !ok {
+		return nil, fmt.Errorf("unknown subscription type: %q", subscriptionType)
+	}
+
+	var subscriptions []model.Subscription
 
 	ctx := context.Background()
-	iter := c.firestoreClient.Collection(path).Documents(ctx)
+	iter := c.firestoreClient.Collection(collection).Documents(ctx)
+	defer iter.Stop()
 
 	for {
 		doc, err := iter.Next()
@@ -96,32 +692,129 @@ func (c *Client) getUris(path string) ([]string, error) {
 			break
 		}
 		if err != nil {
-			fmt.Println("error getting doc:", err)
+			return nil, err
+		}
+
+		var d subscriptionDoc
+		if err := doc.DataTo(&d); err != nil {
+			fmt.Println("error parsing subscription:", err)
 			continue
 		}
 
-		data, err := doc.DataAt("uri")
+		subscription, err := d.toModel(doc.Ref.ID, subscriptionType)
 		if err != nil {
-			fmt.Println("error getting uri:", err)
+			fmt.Println("error parsing subscription:", err)
 			continue
 		}
 
-		uri, ok := data.(string)
-		if !ok {
-			fmt.Println("error parsing uri to string. data:", data)
-			continue
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, nil
+}
+
+func (c *FirestoreClient) UpdateSubscription(subscription model.Subscription) error {
+	current, err := c.GetSubscription(subscription.Id)
+	if err != nil {
+		return err
+	}
+
+	d, err := newSubscriptionDoc(subscription)
+	if err != nil {
+		return err
+	}
+
+	// The creation time is fixed when the subscription is added, and health
+	// is only changed by UpdateSubscriptionHealth, so neither is written
+	ctx := context.Background()
+	_, err = c.firestoreClient.Collection(subscriptionCollections[current.Type]).Doc(subscription.Id).Update(ctx, []firestore.Update{
+		{Path: "uri", Value: d.Uri},
+		{Path: "secret", Value: d.Secret},
+		{Path: "description", Value: d.Description},
+		{Path: "disabled", Value: d.Disabled},
+		{Path: "updated_at", Value: d.UpdatedAt},
+		{Path: "filter", Value: d.Filter},
+		{Path: "template", Value: d.Template},
+		{Path: "format", Value: d.Format},
+	})
+	if status.Code(err) == codes.NotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (c *FirestoreClient) UpdateSubscriptionHealth(id string, update func(health *model.SubscriptionHealth) bool) (model.SubscriptionHealth, error) {
+	current, err := c.GetSubscription(id)
+	if err != nil {
+		return model.SubscriptionHealth{}, err
+	}
+
+	ctx := context.Background()
+	ref := c.firestoreClient.Collection(subscriptionCollections[current.Type]).Doc(id)
+
+	var health model.SubscriptionHealth
+	err = c.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var d subscriptionDoc
+		if err := doc.DataTo(&d); err != nil {
+			return err
+		}
+
+		health = model.SubscriptionHealth{}
+		if current, err := decodeJSON[model.SubscriptionHealth](d.Health); err != nil {
+			return err
+		} else if current != nil {
+			health = *current
+		}
+
+		if !update(&health) {
+			return nil
 		}
 
-		uris = append(uris, uri)
+		h, err := encodeJSON(&health)
+		if err != nil {
+			return err
+		}
+		return tx.Update(ref, []firestore.Update{{Path: "health", Value: h}})
+	})
+	if err != nil {
+		return model.SubscriptionHealth{}, err
 	}
 
-	return uris, nil
+	return health, nil
 }
 
-func (c *Client) GetWebhookUris() ([]string, error) {
-	return c.getUris("webhooks")
+func (c *FirestoreClient) DisableSubscription(id string, at time.Time) error {
+	current, err := c.GetSubscription(id)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	_, err = c.firestoreClient.Collection(subscriptionCollections[current.Type]).Doc(id).Update(ctx, []firestore.Update{
+		{Path: "disabled", Value: true},
+		{Path: "updated_at", Value: at},
+	})
+	if status.Code(err) == codes.NotFound {
+		return ErrNotFound
+	}
+	return err
 }
 
-func (c *Client) GetRawWebhookUris() ([]string, error) {
-	return c.getUris("raw-webhooks")
+func (c *FirestoreClient) DeleteSubscription(id string) error {
+	current, err := c.GetSubscription(id)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	_, err = c.firestoreClient.Collection(subscriptionCollections[current.Type]).Doc(id).Delete(ctx)
+	return err
 }
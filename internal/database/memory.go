@@ -0,0 +1,379 @@
+package database
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+func init() {
+	Register("memory", func(string) (Store, error) {
+		return NewMemoryClient(), nil
+	})
+}
+
+// MemoryClient is an in-process Store. Data does not survive a restart.
+type MemoryClient struct {
+	mu            sync.RWMutex
+	accounts      map[string]model.AccountBalance
+	history       map[string]map[string]model.BalanceSnapshot
+	events        map[string]time.Time
+	deliveries    map[string]model.Delivery
+	subscriptions map[string]model.Subscription
+	attempts      []model.DeliveryAttempt
+}
+
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{
+		accounts:      make(map[string]model.AccountBalance),
+		history:       make(map[string]map[string]model.BalanceSnapshot),
+		events:        make(map[string]time.Time),
+		deliveries:    make(map[string]model.Delivery),
+		subscriptions: make(map[string]model.Subscription),
+	}
+}
+
+func (c *MemoryClient) Close() {}
+
+func (c *MemoryClient) UpdateAccountBalance(balance model.AccountBalance) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if current, ok := c.accounts[balance.AccountId]; ok && current.AsOf.After(balance.AsOf) {
+		return ErrStaleWrite
+	}
+
+	c.accounts[balance.AccountId] = balance
+	return nil
+}
+
+func (c *MemoryClient) GetAccountBalance(accountId string) (model.AccountBalance, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	balance, ok := c.accounts[accountId]
+	if !ok {
+		return model.AccountBalance{}, ErrNotFound
+	}
+
+	return balance, nil
+}
+
+func (c *MemoryClient) ListAccountBalances() ([]model.AccountBalance, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var balances []model.AccountBalance
+	for _, balance := range c.accounts {
+		balances = append(balances, balance)
+	}
+
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].DisplayName < balances[j].DisplayName
+	})
+
+	return balances, nil
+}
+
+func (c *MemoryClient) AddBalanceSnapshot(snapshot model.BalanceSnapshot) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	history, ok := c.history[snapshot.AccountId]
+	if !ok {
+		history = make(map[string]model.BalanceSnapshot)
+		c.history[snapshot.AccountId] = history
+	}
+
+	history[snapshot.TransactionId] = snapshot
+	return nil
+}
+
+func (c *MemoryClient) GetBalanceAt(accountId string, at time.Time) (model.BalanceSnapshot, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var latest *model.BalanceSnapshot
+	for _, snapshot := range c.history[accountId] {
+		if snapshot.CreatedAt.After(at) {
+			continue
+		}
+		if latest == nil || snapshot.CreatedAt.After(latest.CreatedAt) {
+			latest = &snapshot
+		}
+	}
+
+	if latest == nil {
+		return model.BalanceSnapshot{}, ErrNotFound
+	}
+
+	return *latest, nil
+}
+
+func (c *MemoryClient) ListBalanceSnapshots(accountId string, from, to time.Time) ([]model.BalanceSnapshot, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var snapshots []model.BalanceSnapshot
+	for _, snapshot := range c.history[accountId] {
+		if snapshot.CreatedAt.Before(from) || !snapshot.CreatedAt.Before(to) {
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt)
+	})
+
+	return snapshots, nil
+}
+
+func (c *MemoryClient) ClaimEvent(eventId string, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for id, expiresAt := range c.events {
+		if !expiresAt.After(now) {
+			delete(c.events, id)
+		}
+	}
+
+	if _, ok := c.events[eventId]; ok {
+		return false, nil
+	}
+
+	c.events[eventId] = now.Add(ttl)
+	return true, nil
+}
+
+func (c *MemoryClient) ReleaseEvent(eventId string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.events, eventId)
+	return nil
+}
+
+func (c *MemoryClient) CreateDelivery(delivery model.Delivery) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.deliveries[delivery.Id] = delivery
+	return nil
+}
+
+func (c *MemoryClient) UpdateDelivery(delivery model.Delivery) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.deliveries[delivery.Id]; !ok {
+		return ErrNotFound
+	}
+
+	c.deliveries[delivery.Id] = delivery
+	return nil
+}
+
+func (c *MemoryClient) GetDelivery(id string) (model.Delivery, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	delivery, ok := c.deliveries[id]
+	if !ok {
+		return model.Delivery{}, ErrNotFound
+	}
+
+	return delivery, nil
+}
+
+func (c *MemoryClient) ListDeliveries(status model.DeliveryStatus, limit int) ([]model.Delivery, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var deliveries []model.Delivery
+	for _, delivery := range c.deliveries {
+		if delivery.Status == status {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+func (c *MemoryClient) LeaseDeliveries(now time.Time, lease time.Duration, limit int) ([]model.Delivery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var deliveries []model.Delivery
+	for _, delivery := range c.deliveries {
+		if delivery.Status == model.DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttemptAt.Before(deliveries[j].NextAttemptAt)
+	})
+
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	for i := range deliveries {
+		deliveries[i].NextAttemptAt = now.Add(lease)
+		c.deliveries[deliveries[i].Id] = deliveries[i]
+	}
+
+	return deliveries, nil
+}
+
+func (c *MemoryClient) GetEventDelivery(subscriptionId, eventId string) (model.Delivery, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var latest *model.Delivery
+	for _, delivery := range c.deliveries {
+		if delivery.SubscriptionId != subscriptionId || delivery.EventId != eventId {
+			continue
+		}
+		if latest == nil || delivery.CreatedAt.After(latest.CreatedAt) {
+			latest = &delivery
+		}
+	}
+
+	if latest == nil {
+		return model.Delivery{}, ErrNotFound
+	}
+
+	return *latest, nil
+}
+
+func (c *MemoryClient) AddDeliveryAttempt(attempt model.DeliveryAttempt) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.attempts = append(c.attempts, attempt)
+	return nil
+}
+
+func (c *MemoryClient) ListDeliveryAttempts(subscriptionId string, limit int) ([]model.DeliveryAttempt, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// Attempts are appended in order, so walk back from the most recent
+	var attempts []model.DeliveryAttempt
+	for i := len(c.attempts) - 1; i >= 0 && len(attempts) < limit; i-- {
+		if c.attempts[i].SubscriptionId == subscriptionId {
+			attempts = append(attempts, c.attempts[i])
+		}
+	}
+
+	return attempts, nil
+}
+
+func (c *MemoryClient) AddSubscription(subscription model.Subscription) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.subscriptions[subscription.Id] = subscription
+	return nil
+}
+
+func (c *MemoryClient) GetSubscription(id string) (model.Subscription, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	subscription, ok := c.subscriptions[id]
+	if !ok {
+		return model.Subscription{}, ErrNotFound
+	}
+
+	return subscription, nil
+}
+
+func (c *MemoryClient) ListSubscriptions(subscriptionType model.SubscriptionType) ([]model.Subscription, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var subscriptions []model.Subscription
+	for _, subscription := range c.subscriptions {
+		if subscriptionType == "" || subscription.Type == subscriptionType {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].Id < subscriptions[j].Id
+	})
+
+	return subscriptions, nil
+}
+
+func (c *MemoryClient) UpdateSubscription(subscription model.Subscription) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current, ok := c.subscriptions[subscription.Id]
+	if !ok {
+		return ErrNotFound
+	}
+	subscription.Type = current.Type
+	subscription.Health = current.Health
+
+	c.subscriptions[subscription.Id] = subscription
+	return nil
+}
+
+func (c *MemoryClient) UpdateSubscriptionHealth(id string, update func(health *model.SubscriptionHealth) bool) (model.SubscriptionHealth, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	subscription, ok := c.subscriptions[id]
+	if !ok {
+		return model.SubscriptionHealth{}, ErrNotFound
+	}
+
+	if update(&subscription.Health) {
+		c.subscriptions[id] = subscription
+	}
+	return subscription.Health, nil
+}
+
+func (c *MemoryClient) DisableSubscription(id string, at time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	subscription, ok := c.subscriptions[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	subscription.Enabled = false
+	subscription.UpdatedAt = at
+	c.subscriptions[id] = subscription
+	return nil
+}
+
+func (c *MemoryClient) DeleteSubscription(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.subscriptions[id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(c.subscriptions, id)
+	return nil
+}
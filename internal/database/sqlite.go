@@ -0,0 +1,826 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+func init() {
+	Register("sqlite", func(dsn string) (Store, error) {
+		return NewSQLiteClient(dsn)
+	})
+}
+
+// migrations are applied in order and tracked in the schema_migrations table.
+// Existing entries must never be edited; add a new entry instead.
+var migrations = []string{
+	`CREATE TABLE balance (
+		id      TEXT PRIMARY KEY,
+		balance TEXT NOT NULL
+	);
+	CREATE TABLE webhooks (
+		id  INTEGER PRIMARY KEY AUTOINCREMENT,
+		uri TEXT NOT NULL
+	);
+	CREATE TABLE raw_webhooks (
+		id  INTEGER PRIMARY KEY AUTOINCREMENT,
+		uri TEXT NOT NULL
+	);`,
+	// The balance table held a single balance with no account ID, so it
+	// cannot be carried over. Accounts are filled again from the next
+	// webhook event for each of them.
+	`DROP TABLE balance;
+	CREATE TABLE accounts (
+		id             TEXT PRIMARY KEY,
+		display_name   TEXT NOT NULL,
+		account_type   TEXT NOT NULL,
+		ownership_type TEXT NOT NULL,
+		balance        TEXT NOT NULL,
+		currency_code  TEXT NOT NULL,
+		updated_at     TIMESTAMP NOT NULL
+	);`,
+	`CREATE TABLE balance_history (
+		account_id          TEXT NOT NULL,
+		transaction_id      TEXT NOT NULL,
+		balance             TEXT NOT NULL,
+		value_in_base_units INTEGER NOT NULL,
+		currency_code       TEXT NOT NULL,
+		created_at          INTEGER NOT NULL,
+		PRIMARY KEY (account_id, transaction_id)
+	);
+	CREATE INDEX balance_history_created_at ON balance_history (account_id, created_at);`,
+	`ALTER TABLE accounts ADD COLUMN as_of INTEGER NOT NULL DEFAULT 0;`,
+	`CREATE TABLE processed_events (
+		id         TEXT PRIMARY KEY,
+		expires_at INTEGER NOT NULL
+	);
+	CREATE INDEX processed_events_expires_at ON processed_events (expires_at);`,
+	`CREATE TABLE deliveries (
+		id              TEXT PRIMARY KEY,
+		event_id        TEXT NOT NULL,
+		uri             TEXT NOT NULL,
+		content_type    TEXT NOT NULL,
+		payload         BLOB NOT NULL,
+		status          TEXT NOT NULL,
+		attempts        INTEGER NOT NULL,
+		next_attempt_at INTEGER NOT NULL,
+		last_error      TEXT NOT NULL,
+		created_at      INTEGER NOT NULL,
+		updated_at      INTEGER NOT NULL
+	);
+	CREATE INDEX deliveries_status_next_attempt_at ON deliveries (status, next_attempt_at);
+	CREATE INDEX deliveries_status_created_at ON deliveries (status, created_at);`,
+	`CREATE TABLE subscriptions (
+		id     TEXT PRIMARY KEY,
+		type   TEXT NOT NULL,
+		uri    TEXT NOT NULL,
+		secret TEXT NOT NULL DEFAULT ''
+	);
+	INSERT INTO subscriptions (id, type, uri) SELECT 'webhook-' || id, 'summary', uri FROM webhooks;
+	INSERT INTO subscriptions (id, type, uri) SELECT 'raw-webhook-' || id, 'raw', uri FROM raw_webhooks;
+	DROP TABLE webhooks;
+	DROP TABLE raw_webhooks;
+	ALTER TABLE deliveries ADD COLUMN subscription_id TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE subscriptions ADD COLUMN description TEXT NOT NULL DEFAULT '';
+	ALTER TABLE subscriptions ADD COLUMN enabled INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE subscriptions ADD COLUMN created_at INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE subscriptions ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE subscriptions ADD COLUMN filter TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE subscriptions ADD COLUMN template TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE subscriptions ADD COLUMN format TEXT NOT NULL DEFAULT '';
+	ALTER TABLE deliveries ADD COLUMN headers TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE delivery_attempts (
+		id              TEXT PRIMARY KEY,
+		delivery_id     TEXT NOT NULL,
+		subscription_id TEXT NOT NULL,
+		event_id        TEXT NOT NULL,
+		attempt         INTEGER NOT NULL,
+		body_hash       TEXT NOT NULL,
+		status_code     INTEGER NOT NULL,
+		latency         INTEGER NOT NULL,
+		error           TEXT NOT NULL,
+		created_at      INTEGER NOT NULL
+	);
+	CREATE INDEX delivery_attempts_subscription_id_created_at ON delivery_attempts (subscription_id, created_at);
+	CREATE INDEX deliveries_subscription_id_event_id ON deliveries (subscription_id, event_id, created_at);`,
+	`ALTER TABLE subscriptions ADD COLUMN health TEXT NOT NULL DEFAULT '';`,
+}
+
+// SQLiteClient is the embedded SQLite backed Store.
+type SQLiteClient struct {
+	db *sql.DB
+}
+
+func NewSQLiteClient(path string) (*SQLiteClient, error) {
+	if path == "" {
+		path = "balance.db"
+	}
+
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path))
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only supports a single writer
+	db.SetMaxOpenConns(1)
+
+	c := &SQLiteClient{
+		db: db,
+	}
+
+	if err := c.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *SQLiteClient) migrate() error {
+	_, err := c.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return err
+	}
+
+	var version int
+	err = c.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := c.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, i+1); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *SQLiteClient) Close() {
+	c.db.Close()
+}
+
+func (c *SQLiteClient) UpdateAccountBalance(balance model.AccountBalance) error {
+	res, err := c.db.Exec(
+		`INSERT INTO accounts (`+accountColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			display_name = excluded.display_name,
+			account_type = excluded.account_type,
+			ownership_type = excluded.ownership_type,
+			balance = excluded.balance,
+			currency_code = excluded.currency_code,
+			updated_at = excluded.updated_at,
+			as_of = excluded.as_of
+		WHERE excluded.as_of >= accounts.as_of`,
+		balance.AccountId,
+		balance.DisplayName,
+		balance.AccountType,
+		balance.OwnershipType,
+		balance.Balance,
+		balance.CurrencyCode,
+		balance.UpdatedAt.UTC(),
+		balance.AsOf.UnixNano(),
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrStaleWrite
+	}
+
+	return nil
+}
+
+const accountColumns = `id, display_name, account_type, ownership_type, balance, currency_code, updated_at, as_of`
+
+func scanAccountBalance(row interface{ Scan(...any) error }) (model.AccountBalance, error) {
+	var balance model.AccountBalance
+	var asOf int64
+	err := row.Scan(
+		&balance.AccountId,
+		&balance.DisplayName,
+		&balance.AccountType,
+		&balance.OwnershipType,
+		&balance.Balance,
+		&balance.CurrencyCode,
+		&balance.UpdatedAt,
+		&asOf,
+	)
+	balance.AsOf = time.Unix(0, asOf).UTC()
+	return balance, err
+}
+
+func (c *SQLiteClient) GetAccountBalance(accountId string) (model.AccountBalance, error) {
+	row := c.db.QueryRow(`SELECT `+accountColumns+` FROM accounts WHERE id = ?`, accountId)
+
+	balance, err := scanAccountBalance(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.AccountBalance{}, ErrNotFound
+	}
+
+	return balance, err
+}
+
+func (c *SQLiteClient) ListAccountBalances() ([]model.AccountBalance, error) {
+	rows, err := c.db.Query(`SELECT ` + accountColumns + ` FROM accounts ORDER BY display_name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var balances []model.AccountBalance
+	for rows.Next() {
+		balance, err := scanAccountBalance(rows)
+		if err != nil {
+			return nil, err
+		}
+		balances = append(balances, balance)
+	}
+
+	return balances, rows.Err()
+}
+
+// Snapshot times are stored as unix nanoseconds so that they compare and
+// sort correctly.
+const snapshotColumns = `account_id, transaction_id, balance, value_in_base_units, currency_code, created_at`
+
+func scanBalanceSnapshot(row interface{ Scan(...any) error }) (model.BalanceSnapshot, error) {
+	var snapshot model.BalanceSnapshot
+	var createdAt int64
+	err := row.Scan(
+		&snapshot.AccountId,
+		&snapshot.TransactionId,
+		&snapshot.Balance,
+		&snapshot.ValueInBaseUnits,
+		&snapshot.CurrencyCode,
+		&createdAt,
+	)
+	snapshot.CreatedAt = time.Unix(0, createdAt).UTC()
+	return snapshot, err
+}
+
+func (c *SQLiteClient) AddBalanceSnapshot(snapshot model.BalanceSnapshot) error {
+	_, err := c.db.Exec(
+		`INSERT INTO balance_history (`+snapshotColumns+`) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (account_id, transaction_id) DO UPDATE SET
+			balance = excluded.balance,
+			value_in_base_units = excluded.value_in_base_units,
+			currency_code = excluded.currency_code,
+			created_at = excluded.created_at`,
+		snapshot.AccountId,
+		snapshot.TransactionId,
+		snapshot.Balance,
+		snapshot.ValueInBaseUnits,
+		snapshot.CurrencyCode,
+		snapshot.CreatedAt.UnixNano(),
+	)
+	return err
+}
+
+func (c *SQLiteClient) GetBalanceAt(accountId string, at time.Time) (model.BalanceSnapshot, error) {
+	row := c.db.QueryRow(
+		`SELECT `+snapshotColumns+` FROM balance_history
+		WHERE account_id = ? AND created_at <= ?
+		ORDER BY created_at DESC LIMIT 1`,
+		accountId,
+		at.UnixNano(),
+	)
+
+	snapshot, err := scanBalanceSnapshot(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.BalanceSnapshot{}, ErrNotFound
+	}
+
+	return snapshot, err
+}
+
+func (c *SQLiteClient) ListBalanceSnapshots(accountId string, from, to time.Time) ([]model.BalanceSnapshot, error) {
+	rows, err := c.db.Query(
+		`SELECT `+snapshotColumns+` FROM balance_history
+		WHERE account_id = ? AND created_at >= ? AND created_at < ?
+		ORDER BY created_at`,
+		accountId,
+		from.UnixNano(),
+		to.UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []model.BalanceSnapshot
+	for rows.Next() {
+		snapshot, err := scanBalanceSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, rows.Err()
+}
+
+func (c *SQLiteClient) ClaimEvent(eventId string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	_, err := c.db.Exec(`DELETE FROM processed_events WHERE expires_at <= ?`, now.UnixNano())
+	if err != nil {
+		return false, err
+	}
+
+	res, err := c.db.Exec(
+		`INSERT INTO processed_events (id, expires_at) VALUES (?, ?) ON CONFLICT (id) DO NOTHING`,
+		eventId,
+		now.Add(ttl).UnixNano(),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+func (c *SQLiteClient) ReleaseEvent(eventId string) error {
+	_, err := c.db.Exec(`DELETE FROM processed_events WHERE id = ?`, eventId)
+	return err
+}
+
+const deliveryColumns = `id, event_id, uri, content_type, payload, status, attempts, next_attempt_at, last_error, created_at, updated_at, subscription_id, headers`
+
+func scanDelivery(row interface{ Scan(...any) error }) (model.Delivery, error) {
+	var delivery model.Delivery
+	var payload []byte
+	var nextAttemptAt, createdAt, updatedAt int64
+	var headers string
+	err := row.Scan(
+		&delivery.Id,
+		&delivery.EventId,
+		&delivery.Uri,
+		&delivery.ContentType,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&nextAttemptAt,
+		&delivery.LastError,
+		&createdAt,
+		&updatedAt,
+		&delivery.SubscriptionId,
+		&headers,
+	)
+	if err != nil {
+		return delivery, err
+	}
+	delivery.Payload = string(payload)
+	delivery.NextAttemptAt = time.Unix(0, nextAttemptAt).UTC()
+	delivery.CreatedAt = time.Unix(0, createdAt).UTC()
+	delivery.UpdatedAt = time.Unix(0, updatedAt).UTC()
+	if h, err := decodeJSON[map[string]string](headers); err != nil {
+		return delivery, err
+	} else if h != nil {
+		delivery.Headers = *h
+	}
+	return delivery, nil
+}
+
+func scanDeliveries(rows *sql.Rows) ([]model.Delivery, error) {
+	defer rows.Close()
+
+	var deliveries []model.Delivery
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (c *SQLiteClient) CreateDelivery(delivery model.Delivery) error {
+	headers, err := encodeJSON(&delivery.Headers)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.db.Exec(
+		`INSERT INTO deliveries (`+deliveryColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		delivery.Id,
+		delivery.EventId,
+		delivery.Uri,
+		delivery.ContentType,
+		[]byte(delivery.Payload),
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt.UnixNano(),
+		delivery.LastError,
+		delivery.CreatedAt.UnixNano(),
+		delivery.UpdatedAt.UnixNano(),
+		delivery.SubscriptionId,
+		headers,
+	)
+	return err
+}
+
+func (c *SQLiteClient) UpdateDelivery(delivery model.Delivery) error {
+	res, err := c.db.Exec(
+		`UPDATE deliveries SET
+			status = ?,
+			attempts = ?,
+			next_attempt_at = ?,
+			last_error = ?,
+			updated_at = ?
+		WHERE id = ?`,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt.UnixNano(),
+		delivery.LastError,
+		delivery.UpdatedAt.UnixNano(),
+		delivery.Id,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (c *SQLiteClient) GetDelivery(id string) (model.Delivery, error) {
+	row := c.db.QueryRow(`SELECT `+deliveryColumns+` FROM deliveries WHERE id = ?`, id)
+
+	delivery, err := scanDelivery(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Delivery{}, ErrNotFound
+	}
+
+	return delivery, err
+}
+
+func (c *SQLiteClient) ListDeliveries(status model.DeliveryStatus, limit int) ([]model.Delivery, error) {
+	rows, err := c.db.Query(
+		`SELECT `+deliveryColumns+` FROM deliveries WHERE status = ? ORDER BY created_at DESC LIMIT ?`,
+		status,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanDeliveries(rows)
+}
+
+func (c *SQLiteClient) LeaseDeliveries(now time.Time, lease time.Duration, limit int) ([]model.Delivery, error) {
+	rows, err := c.db.Query(
+		`UPDATE deliveries SET next_attempt_at = ?
+		WHERE id IN (
+			SELECT id FROM deliveries
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at LIMIT ?
+		)
+		RETURNING `+deliveryColumns,
+		now.Add(lease).UnixNano(),
+		model.DeliveryPending,
+		now.UnixNano(),
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanDeliveries(rows)
+}
+
+func (c *SQLiteClient) GetEventDelivery(subscriptionId, eventId string) (model.Delivery, error) {
+	row := c.db.QueryRow(
+		`SELECT `+deliveryColumns+` FROM deliveries
+		WHERE subscription_id = ? AND event_id = ?
+		ORDER BY created_at DESC LIMIT 1`,
+		subscriptionId,
+		eventId,
+	)
+
+	delivery, err := scanDelivery(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Delivery{}, ErrNotFound
+	}
+
+	return delivery, err
+}
+
+func (c *SQLiteClient) AddDeliveryAttempt(attempt model.DeliveryAttempt) error {
+	_, err := c.db.Exec(
+		`INSERT INTO delivery_attempts (`+deliveryAttemptColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		attempt.Id,
+		attempt.DeliveryId,
+		attempt.SubscriptionId,
+		attempt.EventId,
+		attempt.Attempt,
+		attempt.BodyHash,
+		attempt.StatusCode,
+		attempt.LatencyMs,
+		attempt.Error,
+		attempt.CreatedAt.UnixNano(),
+	)
+	return err
+}
+
+const deliveryAttemptColumns = `id, delivery_id, subscription_id, event_id, attempt, body_hash, status_code, latency, error, created_at`
+
+func (c *SQLiteClient) ListDeliveryAttempts(subscriptionId string, limit int) ([]model.DeliveryAttempt, error) {
+	rows, err := c.db.Query(
+		`SELECT `+deliveryAttemptColumns+` FROM delivery_attempts
+		WHERE subscription_id = ?
+		ORDER BY created_at DESC LIMIT ?`,
+		subscriptionId,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []model.DeliveryAttempt
+	for rows.Next() {
+		var attempt model.DeliveryAttempt
+		var createdAt int64
+		err := rows.Scan(
+			&attempt.Id,
+			&attempt.DeliveryId,
+			&attempt.SubscriptionId,
+			&attempt.EventId,
+			&attempt.Attempt,
+			&attempt.BodyHash,
+			&attempt.StatusCode,
+			&attempt.LatencyMs,
+			&attempt.Error,
+			&createdAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		attempt.CreatedAt = time.Unix(0, createdAt).UTC()
+		attempts = append(attempts, attempt)
+	}
+
+	return attempts, rows.Err()
+}
+
+func (c *SQLiteClient) AddSubscription(subscription model.Subscription) error {
+	filter, err := encodeJSON(subscription.Filter)
+	if err != nil {
+		return err
+	}
+	template, err := encodeJSON(subscription.Template)
+	if err != nil {
+		return err
+	}
+	health, err := encodeJSON(&subscription.Health)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.db.Exec(
+		`INSERT INTO subscriptions (`+subscriptionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		subscription.Id,
+		subscription.Type,
+		subscription.Uri,
+		subscription.Secret,
+		subscription.Description,
+		subscription.Enabled,
+		subscription.CreatedAt.UnixNano(),
+		subscription.UpdatedAt.UnixNano(),
+		filter,
+		template,
+		subscription.Format,
+		health,
+	)
+	return err
+}
+
+const subscriptionColumns = `id, type, uri, secret, description, enabled, created_at, updated_at, filter, template, format, health`
+
+func scanSubscription(row interface{ Scan(...any) error }) (model.Subscription, error) {
+	var subscription model.Subscription
+	var createdAt, updatedAt int64
+	var filter, template, health string
+	err := row.Scan(
+		&subscription.Id,
+		&subscription.Type,
+		&subscription.Uri,
+		&subscription.Secret,
+		&subscription.Description,
+		&subscription.Enabled,
+		&createdAt,
+		&updatedAt,
+		&filter,
+		&template,
+		&subscription.Format,
+		&health,
+	)
+	if err != nil {
+		return subscription, err
+	}
+	// Subscriptions registered before timestamps were recorded have none
+	if createdAt != 0 {
+		subscription.CreatedAt = time.Unix(0, createdAt).UTC()
+	}
+	if updatedAt != 0 {
+		subscription.UpdatedAt = time.Unix(0, updatedAt).UTC()
+	}
+	if subscription.Filter, err = decodeJSON[model.SubscriptionFilter](filter); err != nil {
+		return subscription, err
+	}
+	if subscription.Template, err = decodeJSON[model.PayloadTemplate](template); err != nil {
+		return subscription, err
+	}
+	if h, err := decodeJSON[model.SubscriptionHealth](health); err != nil {
+		return subscription, err
+	} else if h != nil {
+		subscription.Health = *h
+	}
+	return subscription, nil
+}
+
+func (c *SQLiteClient) GetSubscription(id string) (model.Subscription, error) {
+	row := c.db.QueryRow(`SELECT `+subscriptionColumns+` FROM subscriptions WHERE id = ?`, id)
+
+	subscription, err := scanSubscription(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Subscription{}, ErrNotFound
+	}
+
+	return subscription, err
+}
+
+func (c *SQLiteClient) ListSubscriptions(subscriptionType model.SubscriptionType) ([]model.Subscription, error) {
+	rows, err := c.db.Query(
+		`SELECT `+subscriptionColumns+` FROM subscriptions WHERE ? = '' OR type = ? ORDER BY id`,
+		subscriptionType,
+		subscriptionType,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []model.Subscription
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+func (c *SQLiteClient) UpdateSubscription(subscription model.Subscription) error {
+	filter, err := encodeJSON(subscription.Filter)
+	if err != nil {
+		return err
+	}
+	template, err := encodeJSON(subscription.Template)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.db.Exec(
+		`UPDATE subscriptions SET uri = ?, secret = ?, description = ?, enabled = ?, updated_at = ?, filter = ?, template = ?, format = ?
+		WHERE id = ?`,
+		subscription.Uri,
+		subscription.Secret,
+		subscription.Description,
+		subscription.Enabled,
+		subscription.UpdatedAt.UnixNano(),
+		filter,
+		template,
+		subscription.Format,
+		subscription.Id,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (c *SQLiteClient) UpdateSubscriptionHealth(id string, update func(health *model.SubscriptionHealth) bool) (model.SubscriptionHealth, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return model.SubscriptionHealth{}, err
+	}
+	defer tx.Rollback()
+
+	var h string
+	err = tx.QueryRow(`SELECT health FROM subscriptions WHERE id = ?`, id).Scan(&h)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.SubscriptionHealth{}, ErrNotFound
+	}
+	if err != nil {
+		return model.SubscriptionHealth{}, err
+	}
+
+	var health model.SubscriptionHealth
+	if current, err := decodeJSON[model.SubscriptionHealth](h); err != nil {
+		return model.SubscriptionHealth{}, err
+	} else if current != nil {
+		health = *current
+	}
+
+	if !update(&health) {
+		return health, nil
+	}
+
+	if h, err = encodeJSON(&health); err != nil {
+		return model.SubscriptionHealth{}, err
+	}
+	if _, err := tx.Exec(`UPDATE subscriptions SET health = ? WHERE id = ?`, h, id); err != nil {
+		return model.SubscriptionHealth{}, err
+	}
+
+	return health, tx.Commit()
+}
+
+func (c *SQLiteClient) DisableSubscription(id string, at time.Time) error {
+	res, err := c.db.Exec(`UPDATE subscriptions SET enabled = FALSE, updated_at = ? WHERE id = ?`, at.UnixNano(), id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (c *SQLiteClient) DeleteSubscription(id string) error {
+	res, err := c.db.Exec(`DELETE FROM subscriptions WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,301 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+func newTestSQLiteClient(t *testing.T) *SQLiteClient {
+	t.Helper()
+
+	c, err := NewSQLiteClient(filepath.Join(t.TempDir(), "balance.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+
+	return c
+}
+
+func schemaVersion(t *testing.T, db *sql.DB) int {
+	t.Helper()
+
+	var version int
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+
+	return version
+}
+
+func TestSQLiteMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "balance.db")
+
+	c, err := NewSQLiteClient(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := schemaVersion(t, c.db); v != len(migrations) {
+		t.Errorf("schema version = %d, want %d", v, len(migrations))
+	}
+	c.Close()
+
+	// Opening an up to date database applies nothing
+	c, err = NewSQLiteClient(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if v := schemaVersion(t, c.db); v != len(migrations) {
+		t.Errorf("schema version = %d after reopening, want %d", v, len(migrations))
+	}
+}
+
+func TestSQLiteMigrateWebhooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "balance.db")
+
+	// Set up a database as the first version of the driver left it
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY)`,
+		migrations[0],
+		`INSERT INTO schema_migrations (version) VALUES (1)`,
+		`INSERT INTO balance (id, balance) VALUES ('account-balance', '12.34')`,
+		`INSERT INTO webhooks (uri) VALUES ('https://example.com/summary')`,
+		`INSERT INTO raw_webhooks (uri) VALUES ('https://example.com/raw')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	c, err := NewSQLiteClient(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	subscriptions, err := c.ListSubscriptions("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]model.SubscriptionType{
+		"raw-webhook-1": model.SubscriptionRaw,
+		"webhook-1":     model.SubscriptionSummary,
+	}
+	if len(subscriptions) != len(want) {
+		t.Fatalf("got %d subscriptions, want %d", len(subscriptions), len(want))
+	}
+	for _, subscription := range subscriptions {
+		if subscription.Type != want[subscription.Id] {
+			t.Errorf("subscription %s has type %s, want %s", subscription.Id, subscription.Type, want[subscription.Id])
+		}
+		if !subscription.Enabled {
+			t.Errorf("subscription %s is disabled", subscription.Id)
+		}
+	}
+
+	// The old balance has no account, so it is not carried over
+	if balances, err := c.ListAccountBalances(); err != nil || len(balances) != 0 {
+		t.Errorf("ListAccountBalances() = %v, %v, want none", balances, err)
+	}
+}
+
+func TestSQLiteStaleWrite(t *testing.T) {
+	c := newTestSQLiteClient(t)
+
+	now := time.Now()
+	balance := model.AccountBalance{
+		AccountId:   "acc_1",
+		DisplayName: "Spending",
+		AccountType: "TRANSACTIONAL",
+		Balance:     "10.00",
+		UpdatedAt:   now,
+		AsOf:        now,
+	}
+	if err := c.UpdateAccountBalance(balance); err != nil {
+		t.Fatal(err)
+	}
+
+	// A balance fetched earlier but written later
+	older := balance
+	older.Balance = "20.00"
+	older.AsOf = now.Add(-time.Second)
+	if err := c.UpdateAccountBalance(older); !errors.Is(err, ErrStaleWrite) {
+		t.Errorf("UpdateAccountBalance() = %v, want %v", err, ErrStaleWrite)
+	}
+
+	got, err := c.GetAccountBalance("acc_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Balance != "10.00" {
+		t.Errorf("balance = %s, want 10.00", got.Balance)
+	}
+
+	newer := balance
+	newer.Balance = "30.00"
+	newer.AsOf = now.Add(time.Second)
+	if err := c.UpdateAccountBalance(newer); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.GetAccountBalance("acc_1"); err != nil || got.Balance != "30.00" {
+		t.Errorf("GetAccountBalance() = %v, %v, want balance 30.00", got.Balance, err)
+	}
+}
+
+func TestSQLiteClaimEvent(t *testing.T) {
+	c := newTestSQLiteClient(t)
+
+	for i, want := range []bool{true, false} {
+		claimed, err := c.ClaimEvent("evt_1", time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claimed != want {
+			t.Errorf("claim %d = %v, want %v", i+1, claimed, want)
+		}
+	}
+
+	if err := c.ReleaseEvent("evt_1"); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := c.ClaimEvent("evt_1", time.Hour); err != nil || !claimed {
+		t.Errorf("ClaimEvent() after release = %v, %v, want true", claimed, err)
+	}
+
+	// An expired claim can be taken again
+	if claimed, err := c.ClaimEvent("evt_2", -time.Second); err != nil || !claimed {
+		t.Fatalf("ClaimEvent() = %v, %v, want true", claimed, err)
+	}
+	if claimed, err := c.ClaimEvent("evt_2", time.Hour); err != nil || !claimed {
+		t.Errorf("ClaimEvent() after expiry = %v, %v, want true", claimed, err)
+	}
+}
+
+func TestSQLiteDeliveryAttempts(t *testing.T) {
+	c := newTestSQLiteClient(t)
+
+	now := time.Now()
+	for i, deliveryId := range []string{"del_1", "del_2"} {
+		delivery := model.Delivery{
+			Id:             deliveryId,
+			EventId:        "evt_1",
+			SubscriptionId: "sub_1",
+			Uri:            "https://example.com",
+			Status:         model.DeliveryPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now.Add(time.Duration(i) * time.Second),
+			UpdatedAt:      now,
+		}
+		if err := c.CreateDelivery(delivery); err != nil {
+			t.Fatal(err)
+		}
+
+		attempt := model.DeliveryAttempt{
+			Id:             "att_" + deliveryId,
+			DeliveryId:     deliveryId,
+			SubscriptionId: "sub_1",
+			EventId:        "evt_1",
+			Attempt:        1,
+			StatusCode:     http.StatusOK,
+			CreatedAt:      now.Add(time.Duration(i) * time.Second),
+		}
+		if err := c.AddDeliveryAttempt(attempt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A redelivery is the latest delivery of the event
+	delivery, err := c.GetEventDelivery("sub_1", "evt_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Id != "del_2" {
+		t.Errorf("GetEventDelivery() = %s, want del_2", delivery.Id)
+	}
+	if _, err := c.GetEventDelivery("sub_1", "evt_2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetEventDelivery() = %v, want %v", err, ErrNotFound)
+	}
+
+	attempts, err := c.ListDeliveryAttempts("sub_1", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 || attempts[0].DeliveryId != "del_2" || attempts[1].DeliveryId != "del_1" {
+		t.Errorf("ListDeliveryAttempts() = %+v, want del_2 then del_1", attempts)
+	}
+
+	if attempts, err := c.ListDeliveryAttempts("sub_1", 1); err != nil || len(attempts) != 1 {
+		t.Errorf("ListDeliveryAttempts() with limit 1 = %d attempts, %v, want 1", len(attempts), err)
+	}
+}
+
+func TestSQLiteUpdateSubscriptionHealth(t *testing.T) {
+	c := newTestSQLiteClient(t)
+
+	subscription := model.Subscription{Id: "sub_1", Type: model.SubscriptionSummary, Uri: "https://example.com", Enabled: true}
+	if err := c.AddSubscription(subscription); err != nil {
+		t.Fatal(err)
+	}
+
+	// Concurrent updates are applied one after another
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.UpdateSubscriptionHealth("sub_1", func(health *model.SubscriptionHealth) bool {
+				health.ConsecutiveFailures++
+				return true
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	health, err := c.UpdateSubscriptionHealth("sub_1", func(health *model.SubscriptionHealth) bool {
+		return false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.ConsecutiveFailures != 20 {
+		t.Errorf("consecutive failures = %d, want 20", health.ConsecutiveFailures)
+	}
+
+	if _, err := c.UpdateSubscriptionHealth("missing", func(*model.SubscriptionHealth) bool { return true }); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateSubscriptionHealth() = %v, want %v", err, ErrNotFound)
+	}
+
+	// Disabling leaves the rest of the subscription alone
+	if err := c.DisableSubscription("sub_1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.GetSubscription("sub_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Enabled || got.Uri != subscription.Uri || got.Health.ConsecutiveFailures != 20 {
+		t.Errorf("got %+v, want it disabled and otherwise unchanged", got)
+	}
+	if err := c.DisableSubscription("missing", time.Now()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DisableSubscription() = %v, want %v", err, ErrNotFound)
+	}
+}
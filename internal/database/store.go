@@ -0,0 +1,146 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+
+	// ErrStaleWrite is returned when a write is older than the stored value.
+	ErrStaleWrite = errors.New("stale write")
+)
+
+// Store is the persistence layer behind the service. Each backend registers
+// itself as a driver and is selected at startup.
+type Store interface {
+	// UpdateAccountBalance stores the balance unless a balance with a later
+	// AsOf is already stored, in which case ErrStaleWrite is returned.
+	UpdateAccountBalance(balance model.AccountBalance) error
+	GetAccountBalance(accountId string) (model.AccountBalance, error)
+	ListAccountBalances() ([]model.AccountBalance, error)
+	AddBalanceSnapshot(snapshot model.BalanceSnapshot) error
+	GetBalanceAt(accountId string, at time.Time) (model.BalanceSnapshot, error)
+	ListBalanceSnapshots(accountId string, from, to time.Time) ([]model.BalanceSnapshot, error)
+	// ClaimEvent records that an event has been processed. It returns false
+	// if the event was already claimed within the last ttl.
+	ClaimEvent(eventId string, ttl time.Duration) (bool, error)
+	// ReleaseEvent forgets a claimed event so that it can be processed again.
+	ReleaseEvent(eventId string) error
+	CreateDelivery(delivery model.Delivery) error
+	UpdateDelivery(delivery model.Delivery) error
+	GetDelivery(id string) (model.Delivery, error)
+	// ListDeliveries returns the most recently created deliveries with the
+	// given status.
+	ListDeliveries(status model.DeliveryStatus, limit int) ([]model.Delivery, error)
+	// LeaseDeliveries returns pending deliveries that are due at now, and
+	// pushes their NextAttemptAt back by lease so that no other caller picks
+	// them up while they are attempted.
+	LeaseDeliveries(now time.Time, lease time.Duration, limit int) ([]model.Delivery, error)
+	// GetEventDelivery returns the latest delivery of an event to a
+	// subscription.
+	GetEventDelivery(subscriptionId, eventId string) (model.Delivery, error)
+	AddDeliveryAttempt(attempt model.DeliveryAttempt) error
+	// ListDeliveryAttempts returns the most recent attempts to deliver to a
+	// subscription.
+	ListDeliveryAttempts(subscriptionId string, limit int) ([]model.DeliveryAttempt, error)
+	AddSubscription(subscription model.Subscription) error
+	GetSubscription(id string) (model.Subscription, error)
+	// ListSubscriptions returns the subscriptions of the given type, or of
+	// every type if subscriptionType is empty.
+	ListSubscriptions(subscriptionType model.SubscriptionType) ([]model.Subscription, error)
+	// UpdateSubscription replaces a stored subscription. The type of a
+	// subscription is fixed when it is added, and its health is only updated
+	// by UpdateSubscriptionHealth.
+	UpdateSubscription(subscription model.Subscription) error
+	// UpdateSubscriptionHealth applies update to a subscription's stored
+	// health atomically, so that concurrent deliveries do not overwrite each
+	// other's changes, and returns the result. The health is only written if
+	// update returns true. update may be called more than once.
+	UpdateSubscriptionHealth(id string, update func(health *model.SubscriptionHealth) bool) (model.SubscriptionHealth, error)
+	// DisableSubscription switches a subscription off without changing the
+	// rest of it.
+	DisableSubscription(id string, at time.Time) error
+	DeleteSubscription(id string) error
+	Close()
+}
+
+// Driver opens a Store from a driver specific data source name.
+type Driver func(dsn string) (Store, error)
+
+var drivers = map[string]Driver{}
+
+// Register makes a storage driver available by name. It panics if a driver
+// is registered twice.
+func Register(name string, driver Driver) {
+	if _, ok := drivers[name]; ok {
+		panic("database: driver registered twice: " + name)
+	}
+	drivers[name] = driver
+}
+
+// Drivers returns the names of the registered drivers.
+func Drivers() []string {
+	var names []string
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens a Store using the named driver.
+func Open(driver, dsn string) (Store, error) {
+	d, ok := drivers[driver]
+	if !ok {
+		return nil, fmt.Errorf("unknown database driver: %q (available: %v)", driver, Drivers())
+	}
+	return d(dsn)
+}
+
+// GetStore opens the Store configured by DATABASE_DRIVER and DATABASE_DSN.
+// Firestore is used by default with GCP_PROJECT as the project.
+func GetStore() (Store, error) {
+	driver := os.Getenv("DATABASE_DRIVER")
+	if driver == "" {
+		driver = "firestore"
+	}
+
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" && driver == "firestore" {
+		dsn = os.Getenv("GCP_PROJECT")
+	}
+
+	return Open(driver, dsn)
+}
+
+// encodeJSON stores an optional nested value, such as a subscription filter,
+// as a JSON string. A nil value is stored as an empty string.
+func encodeJSON[T any](v *T) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func decodeJSON[T any](s string) (*T, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var v T
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
@@ -0,0 +1,126 @@
+package delivery
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// maxDrain is how much of a response body is read so that the connection can
+// be reused. Larger bodies are dropped with their connection.
+const maxDrain = 64 << 10
+
+// Limits bound the resources used to deliver to subscribers, so that a long
+// subscriber list or slow subscribers cannot hold up event processing.
+type Limits struct {
+	// Concurrency is how many deliveries are sent at once.
+	Concurrency int
+
+	// Timeout bounds a whole delivery request, including reading the
+	// response.
+	Timeout time.Duration
+
+	// MaxConnsPerHost limits connections to a single subscriber host.
+	MaxConnsPerHost int
+
+	// FirstAttemptWait is how long Deliver waits for first attempts. Zero
+	// leaves them all to the retry loop.
+	FirstAttemptWait time.Duration
+
+	// AllowPrivateNetworks lets deliveries reach loopback, private and
+	// link-local addresses. It is off so that subscriber URIs cannot reach
+	// internal services or the metadata server.
+	AllowPrivateNetworks bool
+}
+
+// LimitsFromEnv reads the limits from DELIVERY_CONCURRENCY, DELIVERY_TIMEOUT,
+// DELIVERY_MAX_CONNS_PER_HOST, DELIVERY_FIRST_ATTEMPT_WAIT and
+// DELIVERY_ALLOW_PRIVATE_NETWORKS.
+func LimitsFromEnv() Limits {
+	l := Limits{
+		Concurrency:      16,
+		Timeout:          10 * time.Second,
+		MaxConnsPerHost:  4,
+		FirstAttemptWait: 5 * time.Second,
+	}
+
+	if n, err := strconv.Atoi(os.Getenv("DELIVERY_CONCURRENCY")); err == nil && n > 0 {
+		l.Concurrency = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("DELIVERY_TIMEOUT")); err == nil && d > 0 {
+		l.Timeout = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("DELIVERY_MAX_CONNS_PER_HOST")); err == nil && n > 0 {
+		l.MaxConnsPerHost = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("DELIVERY_FIRST_ATTEMPT_WAIT")); err == nil && d >= 0 {
+		l.FirstAttemptWait = d
+	}
+	if b, err := strconv.ParseBool(os.Getenv("DELIVERY_ALLOW_PRIVATE_NETWORKS")); err == nil {
+		l.AllowPrivateNetworks = b
+	}
+
+	return l
+}
+
+// newClient returns the client shared by every delivery.
+func newClient(limits Limits) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if !limits.AllowPrivateNetworks {
+		dialer.Control = publicOnly
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   limits.MaxConnsPerHost,
+		MaxConnsPerHost:       limits.MaxConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: limits.Timeout,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   limits.Timeout,
+	}
+}
+
+var ErrPrivateAddress = errors.New("subscriber address is not public")
+
+// publicOnly refuses connections to addresses that are not on the public
+// internet. It runs after DNS resolution, so it also covers redirects and
+// hostnames that resolve to internal addresses.
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+
+	return nil
+}
+
+// drain reads what is left of a response body so that its connection can go
+// back to the pool, then closes it.
+func drain(body io.ReadCloser) {
+	io.Copy(io.Discard, io.LimitReader(body, maxDrain))
+	body.Close()
+}
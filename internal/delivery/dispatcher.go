@@ -0,0 +1,493 @@
+// Package delivery sends webhook events to subscribers. Every delivery is
+// persisted before it is attempted so that failed deliveries can be retried
+// with backoff, and deliveries that exhaust their attempts are kept as dead
+// letters until they are redriven.
+package delivery
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/baely/balance/internal/database"
+	"github.com/baely/balance/internal/metrics"
+	"github.com/baely/balance/pkg/model"
+	"github.com/baely/balance/pkg/webhook"
+)
+
+const (
+	// leaseDuration is how long a delivery is hidden from other dispatchers
+	// while it is being attempted.
+	leaseDuration = 2 * time.Minute
+	pollInterval  = 10 * time.Second
+	pollBatchSize = 50
+)
+
+var ErrNotDead = errors.New("delivery is not a dead letter")
+
+// Policy controls how failed deliveries are retried, and when failing
+// subscribers are cut off.
+type Policy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+
+	// FailureThreshold is how many consecutive failures open a subscriber's
+	// circuit. While it is open, one delivery is let through every
+	// ProbeInterval.
+	FailureThreshold int
+	ProbeInterval    time.Duration
+
+	// DisableAfter is how long a subscriber can fail before it is disabled.
+	// Zero never disables subscribers.
+	DisableAfter time.Duration
+}
+
+// PolicyFromEnv reads the policy from DELIVERY_MAX_ATTEMPTS,
+// DELIVERY_BASE_DELAY, DELIVERY_MAX_DELAY, SUBSCRIPTION_FAILURE_THRESHOLD,
+// SUBSCRIPTION_PROBE_INTERVAL and SUBSCRIPTION_DISABLE_AFTER.
+func PolicyFromEnv() Policy {
+	p := Policy{
+		MaxAttempts:      8,
+		BaseDelay:        30 * time.Second,
+		MaxDelay:         time.Hour,
+		FailureThreshold: 5,
+		ProbeInterval:    5 * time.Minute,
+		DisableAfter:     72 * time.Hour,
+	}
+
+	if n, err := strconv.Atoi(os.Getenv("DELIVERY_MAX_ATTEMPTS")); err == nil && n > 0 {
+		p.MaxAttempts = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("DELIVERY_BASE_DELAY")); err == nil && d > 0 {
+		p.BaseDelay = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("DELIVERY_MAX_DELAY")); err == nil && d > 0 {
+		p.MaxDelay = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("SUBSCRIPTION_FAILURE_THRESHOLD")); err == nil && n > 0 {
+		p.FailureThreshold = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("SUBSCRIPTION_PROBE_INTERVAL")); err == nil && d > 0 {
+		p.ProbeInterval = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("SUBSCRIPTION_DISABLE_AFTER")); err == nil && d >= 0 {
+		p.DisableAfter = d
+	}
+
+	return p
+}
+
+// Backoff returns the delay before the next attempt once attempts attempts
+// have failed. The delay doubles with each attempt up to MaxDelay, and half of
+// it is randomised so that retries to the same subscriber spread out.
+func (p Policy) Backoff(attempts int) time.Duration {
+	// Doubling stops at MaxDelay, so large attempt counts cannot overflow
+	d := p.BaseDelay
+	for i := 1; i < attempts && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// Dispatcher sends deliveries with at most Limits.Concurrency requests in
+// flight, shared between new deliveries and retries.
+type Dispatcher struct {
+	store  database.Store
+	client *http.Client
+	policy Policy
+	limits Limits
+	slots  chan struct{}
+}
+
+func NewDispatcher(store database.Store, policy Policy, limits Limits) *Dispatcher {
+	return &Dispatcher{
+		store:  store,
+		client: newClient(limits),
+		policy: policy,
+		limits: limits,
+		slots:  make(chan struct{}, limits.Concurrency),
+	}
+}
+
+// Payload is the request sent to a subscriber.
+type Payload struct {
+	Body        []byte
+	ContentType string
+	Headers     map[string]string
+}
+
+// Target is a subscriber and the payload it is sent.
+type Target struct {
+	Subscription model.Subscription
+	Payload      Payload
+}
+
+// Deliver persists a delivery of an event to each target, then makes their
+// first attempts, waiting at most Limits.FirstAttemptWait for them. Waiting
+// keeps the requests inside the caller's, so they are not starved where CPU is
+// only allocated while a request is served, such as Cloud Run. Deliveries that
+// get no slot in time are left to Run or RetryDue, as are failed attempts,
+// and attempts still in flight finish in the background. An error means some
+// deliveries could not be persisted.
+func (d *Dispatcher) Deliver(ctx context.Context, eventId string, targets []Target) error {
+	var deliveries []model.Delivery
+	var err error
+	for _, target := range targets {
+		var delivery model.Delivery
+		if delivery, err = d.create(eventId, target.Subscription, target.Payload); err != nil {
+			// Those already persisted are still attempted
+			break
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	d.attemptFirst(ctx, deliveries)
+	return err
+}
+
+// create persists a pending delivery, leased so that the retry poll leaves it
+// alone while its first attempt is made.
+func (d *Dispatcher) create(eventId string, subscription model.Subscription, payload Payload) (model.Delivery, error) {
+	if _, err := url.Parse(subscription.Uri); err != nil {
+		return model.Delivery{}, err
+	}
+
+	now := time.Now()
+	delivery := model.Delivery{
+		Id:             uuid.NewString(),
+		EventId:        eventId,
+		SubscriptionId: subscription.Id,
+		Uri:            subscription.Uri,
+		ContentType:    payload.ContentType,
+		Headers:        payload.Headers,
+		Payload:        string(payload.Body),
+		Status:         model.DeliveryPending,
+		NextAttemptAt:  now.Add(leaseDuration),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	if err := d.store.CreateDelivery(delivery); err != nil {
+		return model.Delivery{}, err
+	}
+
+	return delivery, nil
+}
+
+// attemptFirst makes the first attempts of new deliveries until
+// Limits.FirstAttemptWait has passed. Those not started by then are released
+// to the retry loop rather than waiting out their lease.
+func (d *Dispatcher) attemptFirst(ctx context.Context, deliveries []model.Delivery) {
+	if d.limits.FirstAttemptWait <= 0 {
+		d.release(deliveries)
+		return
+	}
+
+	wait, cancel := context.WithTimeout(ctx, d.limits.FirstAttemptWait)
+	defer cancel()
+
+	// Attempts are bounded by the client timeout rather than the wait, so
+	// that running out of time is not recorded as a failure
+	ctx = context.WithoutCancel(ctx)
+
+	done := make(chan struct{}, len(deliveries))
+	for i, delivery := range deliveries {
+		select {
+		case d.slots <- struct{}{}:
+		case <-wait.Done():
+			d.release(deliveries[i:])
+			return
+		}
+
+		go func() {
+			defer func() {
+				<-d.slots
+				done <- struct{}{}
+			}()
+			d.attempt(ctx, delivery)
+		}()
+	}
+
+	for range deliveries {
+		select {
+		case <-done:
+		case <-wait.Done():
+			return
+		}
+	}
+}
+
+// release makes deliveries due now, so that the retry loop picks them up.
+func (d *Dispatcher) release(deliveries []model.Delivery) {
+	now := time.Now()
+	for _, delivery := range deliveries {
+		fmt.Println("leaving first attempt to retries:", delivery.Id)
+		delivery.NextAttemptAt = now
+		delivery.UpdatedAt = now
+		d.save(delivery)
+	}
+}
+
+// attemptAll attempts deliveries concurrently and waits for them.
+func (d *Dispatcher) attemptAll(ctx context.Context, deliveries []model.Delivery) []model.Delivery {
+	// Requests in flight are bounded by the client timeout rather than
+	// cancelled, so that the caller going away is not recorded as a failure
+	ctx = context.WithoutCancel(ctx)
+
+	results := make([]model.Delivery, len(deliveries))
+	wg := &sync.WaitGroup{}
+	for i, delivery := range deliveries {
+		d.slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-d.slots
+				wg.Done()
+			}()
+			results[i] = d.attempt(ctx, delivery)
+		}()
+	}
+
+	wg.Wait()
+	return results
+}
+
+// Redrive moves a dead letter back to pending with a fresh set of attempts,
+// and attempts it.
+func (d *Dispatcher) Redrive(ctx context.Context, id string) (model.Delivery, error) {
+	delivery, err := d.store.GetDelivery(id)
+	if err != nil {
+		return model.Delivery{}, err
+	}
+
+	if delivery.Status != model.DeliveryDead {
+		return model.Delivery{}, ErrNotDead
+	}
+
+	now := time.Now()
+	delivery.Status = model.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = now.Add(leaseDuration)
+	delivery.UpdatedAt = now
+
+	if err := d.store.UpdateDelivery(delivery); err != nil {
+		return model.Delivery{}, err
+	}
+
+	return d.attemptAll(ctx, []model.Delivery{delivery})[0], nil
+}
+
+// Redeliver sends the latest delivery of an event to a subscription again as
+// a new delivery, whatever the outcome of the original.
+func (d *Dispatcher) Redeliver(ctx context.Context, subscriptionId, eventId string) (model.Delivery, error) {
+	original, err := d.store.GetEventDelivery(subscriptionId, eventId)
+	if err != nil {
+		return model.Delivery{}, err
+	}
+
+	subscription, err := d.store.GetSubscription(subscriptionId)
+	if err != nil {
+		return model.Delivery{}, err
+	}
+
+	delivery, err := d.create(eventId, subscription, Payload{
+		Body:        []byte(original.Payload),
+		ContentType: original.ContentType,
+		Headers:     original.Headers,
+	})
+	if err != nil {
+		return model.Delivery{}, err
+	}
+
+	return d.attemptAll(ctx, []model.Delivery{delivery})[0], nil
+}
+
+// Run retries due deliveries until ctx is done. It needs CPU between
+// requests, so where that is not allocated, call RetryDue on a schedule
+// instead.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.RetryDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RetryDue attempts a batch of deliveries whose retry is due and waits for
+// them. It returns how many were attempted.
+func (d *Dispatcher) RetryDue(ctx context.Context) int {
+	deliveries, err := d.store.LeaseDeliveries(time.Now(), leaseDuration, pollBatchSize)
+	if err != nil {
+		fmt.Println("error leasing deliveries:", err)
+		return 0
+	}
+
+	for _, delivery := range deliveries {
+		fmt.Println("retrying delivery:", delivery.Id, "attempt:", delivery.Attempts+1)
+	}
+
+	d.attemptAll(ctx, deliveries)
+	return len(deliveries)
+}
+
+// attempt sends the delivery once and records the outcome. Deliveries to a
+// subscriber whose circuit is open are held back without being sent.
+func (d *Dispatcher) attempt(ctx context.Context, delivery model.Delivery) model.Delivery {
+	var subscription *model.Subscription
+	if delivery.SubscriptionId != "" {
+		s, err := d.store.GetSubscription(delivery.SubscriptionId)
+		if errors.Is(err, database.ErrNotFound) {
+			return d.deadLetter(delivery, errors.New("subscription was deleted"))
+		}
+		if err != nil {
+			// The delivery stays leased and is retried once the lease expires
+			fmt.Println("error retrieving subscription:", delivery.SubscriptionId, err)
+			return delivery
+		}
+		if !s.Enabled {
+			return d.deadLetter(delivery, errors.New("subscription is disabled"))
+		}
+		if ok, until := d.allow(s, time.Now()); !ok {
+			delivery.NextAttemptAt = until
+			delivery.UpdatedAt = time.Now()
+			return d.save(delivery)
+		}
+		subscription = &s
+	}
+
+	start := time.Now()
+	statusCode, err := d.send(ctx, delivery, subscription)
+	metrics.DeliveryAttempts.Add(1)
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.UpdatedAt = now
+
+	d.recordAttempt(delivery, statusCode, now.Sub(start), err, now)
+	if subscription != nil {
+		d.recordHealth(subscription.Id, err, now)
+	}
+
+	switch {
+	case err == nil:
+		delivery.Status = model.DeliverySucceeded
+		delivery.LastError = ""
+	case delivery.Attempts >= d.policy.MaxAttempts:
+		metrics.DeliveryFailures.Add(1)
+		return d.deadLetter(delivery, err)
+	default:
+		fmt.Println("delivery failed, will retry:", delivery.Id, err)
+		metrics.DeliveryFailures.Add(1)
+		delivery.NextAttemptAt = now.Add(d.policy.Backoff(delivery.Attempts))
+		delivery.LastError = err.Error()
+	}
+
+	return d.save(delivery)
+}
+
+func (d *Dispatcher) deadLetter(delivery model.Delivery, err error) model.Delivery {
+	fmt.Println("delivery failed, moving to dead letters:", delivery.Id, err)
+	metrics.DeadLetters.Add(1)
+	delivery.Status = model.DeliveryDead
+	delivery.LastError = err.Error()
+	delivery.UpdatedAt = time.Now()
+
+	return d.save(delivery)
+}
+
+func (d *Dispatcher) save(delivery model.Delivery) model.Delivery {
+	if err := d.store.UpdateDelivery(delivery); err != nil {
+		fmt.Println("error updating delivery:", delivery.Id, err)
+	}
+
+	return delivery
+}
+
+// sign adds Standard Webhooks signature headers using the subscriber's
+// secret. The delivery ID is the message ID, so it is stable across retries
+// and receivers can use it to deduplicate.
+func sign(req *http.Request, delivery model.Delivery, subscription *model.Subscription) error {
+	// Subscriptions registered before signing was introduced have no secret
+	if subscription == nil || subscription.Secret == "" {
+		return nil
+	}
+
+	return webhook.SetHeaders(req.Header, subscription.Secret, delivery.Id, time.Now(), []byte(delivery.Payload))
+}
+
+func (d *Dispatcher) recordAttempt(delivery model.Delivery, statusCode int, latency time.Duration, err error, now time.Time) {
+	hash := sha256.Sum256([]byte(delivery.Payload))
+	attempt := model.DeliveryAttempt{
+		Id:             uuid.NewString(),
+		DeliveryId:     delivery.Id,
+		SubscriptionId: delivery.SubscriptionId,
+		EventId:        delivery.EventId,
+		Attempt:        delivery.Attempts,
+		BodyHash:       hex.EncodeToString(hash[:]),
+		StatusCode:     statusCode,
+		LatencyMs:      latency.Milliseconds(),
+		CreatedAt:      now,
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	if err := d.store.AddDeliveryAttempt(attempt); err != nil {
+		fmt.Println("error recording delivery attempt:", delivery.Id, err)
+	}
+}
+
+// send makes the request for a delivery. It returns the response status code,
+// or zero if no response was received.
+func (d *Dispatcher) send(ctx context.Context, delivery model.Delivery, subscription *model.Subscription) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Uri, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	for k, v := range delivery.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", delivery.ContentType)
+
+	if err := sign(req, delivery, subscription); err != nil {
+		return 0, err
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer drain(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("request failed with status: %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
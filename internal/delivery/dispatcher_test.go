@@ -0,0 +1,282 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/baely/balance/internal/database"
+	"github.com/baely/balance/pkg/model"
+	"github.com/baely/balance/pkg/webhook"
+)
+
+func TestPolicyBackoff(t *testing.T) {
+	p := Policy{BaseDelay: 30 * time.Second, MaxDelay: time.Hour}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 30 * time.Second},
+		{attempts: 2, want: time.Minute},
+		{attempts: 5, want: 8 * time.Minute},
+		{attempts: 8, want: time.Hour},
+		{attempts: 64, want: time.Hour},
+		{attempts: 1 << 30, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			got := p.Backoff(tt.attempts)
+			if got < tt.want/2 || got > tt.want {
+				t.Fatalf("Backoff(%d) = %v, want between %v and %v", tt.attempts, got, tt.want/2, tt.want)
+			}
+		}
+	}
+}
+
+func testDispatcher(store database.Store) *Dispatcher {
+	return NewDispatcher(store, Policy{
+		MaxAttempts:      2,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         time.Millisecond,
+		FailureThreshold: 5,
+		ProbeInterval:    time.Minute,
+	}, Limits{
+		Concurrency:          2,
+		Timeout:              time.Second,
+		MaxConnsPerHost:      2,
+		FirstAttemptWait:     time.Second,
+		AllowPrivateNetworks: true,
+	})
+}
+
+func TestDeliver(t *testing.T) {
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls atomic.Int32
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first attempt so that it is left for a retry
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify(secret, r.Header, body); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer subscriber.Close()
+
+	store := database.NewMemoryClient()
+	subscription := model.Subscription{Id: "sub_1", Uri: subscriber.URL, Secret: secret, Enabled: true}
+	if err := store.AddSubscription(subscription); err != nil {
+		t.Fatal(err)
+	}
+
+	d := testDispatcher(store)
+	ctx := context.Background()
+
+	err = d.Deliver(ctx, "evt_1", []Target{{
+		Subscription: subscription,
+		Payload:      Payload{Body: []byte(`{"balance":"10.00"}`), ContentType: "application/json"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first attempt is made before Deliver returns
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("subscriber called %d times, want 1", n)
+	}
+	delivery, err := store.GetEventDelivery(subscription.Id, "evt_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != model.DeliveryPending || delivery.Attempts != 1 {
+		t.Fatalf("delivery is %s after %d attempts, want pending after 1", delivery.Status, delivery.Attempts)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if n := d.RetryDue(ctx); n != 1 {
+		t.Fatalf("RetryDue() = %d, want 1", n)
+	}
+
+	delivery, err = store.GetDelivery(delivery.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != model.DeliverySucceeded || delivery.Attempts != 2 {
+		t.Errorf("delivery is %s after %d attempts, want succeeded after 2", delivery.Status, delivery.Attempts)
+	}
+}
+
+func TestDeliverDeadLetter(t *testing.T) {
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer subscriber.Close()
+
+	store := database.NewMemoryClient()
+	subscription := model.Subscription{Id: "sub_1", Uri: subscriber.URL, Enabled: true}
+	if err := store.AddSubscription(subscription); err != nil {
+		t.Fatal(err)
+	}
+
+	d := testDispatcher(store)
+	ctx := context.Background()
+
+	if err := d.Deliver(ctx, "evt_1", []Target{{Subscription: subscription, Payload: Payload{Body: []byte("{}")}}}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	d.RetryDue(ctx)
+
+	delivery, err := store.GetEventDelivery(subscription.Id, "evt_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != model.DeliveryDead {
+		t.Fatalf("delivery is %s, want dead", delivery.Status)
+	}
+
+	redriven, err := d.Redrive(ctx, delivery.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redriven.Status != model.DeliveryPending || redriven.Attempts != 1 {
+		t.Errorf("redriven delivery is %s after %d attempts, want pending after 1", redriven.Status, redriven.Attempts)
+	}
+
+	if _, err := d.Redrive(ctx, delivery.Id); !errors.Is(err, ErrNotDead) {
+		t.Errorf("Redrive() = %v, want %v", err, ErrNotDead)
+	}
+}
+
+func TestDeliverFirstAttemptWait(t *testing.T) {
+	unblock := make(chan struct{})
+	var calls atomic.Int32
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			<-unblock
+		}
+	}))
+	defer subscriber.Close()
+	defer close(unblock)
+
+	store := database.NewMemoryClient()
+	var targets []Target
+	for _, id := range []string{"sub_1", "sub_2"} {
+		subscription := model.Subscription{Id: id, Uri: subscriber.URL, Enabled: true}
+		if err := store.AddSubscription(subscription); err != nil {
+			t.Fatal(err)
+		}
+		targets = append(targets, Target{Subscription: subscription, Payload: Payload{Body: []byte("{}")}})
+	}
+
+	// One slot, taken by a first attempt that outlasts the wait
+	d := NewDispatcher(store, Policy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}, Limits{
+		Concurrency:          1,
+		Timeout:              5 * time.Second,
+		FirstAttemptWait:     50 * time.Millisecond,
+		AllowPrivateNetworks: true,
+	})
+	ctx := context.Background()
+
+	start := time.Now()
+	if err := d.Deliver(ctx, "evt_1", targets); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Deliver() took %v, want it to return after the wait", elapsed)
+	}
+
+	// The attempt in flight keeps its lease, and the other is left to retries
+	inFlight, err := store.GetEventDelivery("sub_1", "evt_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inFlight.Attempts != 0 || !inFlight.NextAttemptAt.After(time.Now()) {
+		t.Errorf("in flight delivery has %d attempts and is due at %v, want it leased", inFlight.Attempts, inFlight.NextAttemptAt)
+	}
+	released, err := store.GetEventDelivery("sub_2", "evt_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if released.Attempts != 0 || released.NextAttemptAt.After(time.Now()) {
+		t.Errorf("released delivery has %d attempts and is due at %v, want it due now", released.Attempts, released.NextAttemptAt)
+	}
+
+	unblock <- struct{}{}
+	if n := d.RetryDue(ctx); n != 1 {
+		t.Fatalf("RetryDue() = %d, want 1", n)
+	}
+	if released, err = store.GetDelivery(released.Id); err != nil || released.Status != model.DeliverySucceeded {
+		t.Errorf("released delivery is %s, %v, want succeeded", released.Status, err)
+	}
+}
+
+func TestDeliverWithoutWaiting(t *testing.T) {
+	var calls atomic.Int32
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer subscriber.Close()
+
+	store := database.NewMemoryClient()
+	subscription := model.Subscription{Id: "sub_1", Uri: subscriber.URL, Enabled: true}
+	if err := store.AddSubscription(subscription); err != nil {
+		t.Fatal(err)
+	}
+
+	limits := Limits{Concurrency: 1, Timeout: time.Second, AllowPrivateNetworks: true}
+	d := NewDispatcher(store, Policy{MaxAttempts: 2}, limits)
+	ctx := context.Background()
+
+	if err := d.Deliver(ctx, "evt_1", []Target{{Subscription: subscription, Payload: Payload{Body: []byte("{}")}}}); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Fatalf("subscriber called %d times, want none before the retry loop", n)
+	}
+
+	if n := d.RetryDue(ctx); n != 1 || calls.Load() != 1 {
+		t.Errorf("RetryDue() = %d with %d calls, want 1 and 1", n, calls.Load())
+	}
+}
+
+func TestPublicOnly(t *testing.T) {
+	tests := []struct {
+		address string
+		public  bool
+	}{
+		{address: "93.184.216.34:443", public: true},
+		{address: "[2606:2800:220:1:248:1893:25c8:1946]:443", public: true},
+		{address: "127.0.0.1:80"},
+		{address: "10.0.0.5:80"},
+		{address: "192.168.1.1:80"},
+		{address: "169.254.169.254:80"},
+		{address: "0.0.0.0:80"},
+		{address: "[::1]:80"},
+		{address: "[fd00::1]:80"},
+	}
+
+	for _, tt := range tests {
+		err := publicOnly("tcp", tt.address, nil)
+		if tt.public && err != nil {
+			t.Errorf("publicOnly(%s) = %v, want nil", tt.address, err)
+		}
+		if !tt.public && !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("publicOnly(%s) = %v, want %v", tt.address, err, ErrPrivateAddress)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package delivery
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/baely/balance/internal/metrics"
+	"github.com/baely/balance/pkg/model"
+)
+
+// allow reports whether a delivery to subscription can be sent at now, or
+// else until when it is held back. While the circuit is open one delivery is
+// let through as a probe each ProbeInterval. The probe is claimed atomically,
+// so deliveries held back until the same time do not all probe at once.
+func (d *Dispatcher) allow(subscription model.Subscription, now time.Time) (bool, time.Time) {
+	if !subscription.Health.CircuitOpen {
+		return true, time.Time{}
+	}
+	if next := subscription.Health.NextProbeAt; next != nil && now.Before(*next) {
+		return false, *next
+	}
+
+	var allowed, claimed bool
+	health, err := d.store.UpdateSubscriptionHealth(subscription.Id, func(health *model.SubscriptionHealth) bool {
+		allowed, claimed = false, false
+		switch {
+		case !health.CircuitOpen:
+			// Closed since the subscription was read
+			allowed = true
+			return false
+		case health.NextProbeAt != nil && now.Before(*health.NextProbeAt):
+			// Another delivery claimed the probe
+			return false
+		}
+
+		// Hold back other deliveries until the probe has finished
+		next := now.Add(d.policy.ProbeInterval)
+		health.NextProbeAt = &next
+		allowed, claimed = true, true
+		return true
+	})
+	if err != nil {
+		fmt.Println("error updating subscription health:", subscription.Id, err)
+		return false, now.Add(d.policy.ProbeInterval)
+	}
+
+	if claimed {
+		fmt.Println("probing subscription:", subscription.Id)
+	}
+	if !allowed {
+		return false, *health.NextProbeAt
+	}
+	return true, time.Time{}
+}
+
+// recordHealth updates a subscription's health after a delivery attempt.
+// Concurrent attempts each count, since the update is atomic.
+func (d *Dispatcher) recordHealth(id string, err error, now time.Time) {
+	var opened, closed, disable bool
+	_, updateErr := d.store.UpdateSubscriptionHealth(id, func(health *model.SubscriptionHealth) bool {
+		opened, closed, disable = false, false, false
+
+		if err == nil {
+			if health.ConsecutiveFailures == 0 && !health.CircuitOpen {
+				return false
+			}
+			closed = health.CircuitOpen
+			*health = model.SubscriptionHealth{}
+			return true
+		}
+
+		health.ConsecutiveFailures++
+		if health.FailingSince == nil {
+			failingSince := now
+			health.FailingSince = &failingSince
+		}
+
+		if !health.CircuitOpen && health.ConsecutiveFailures >= d.policy.FailureThreshold {
+			next := now.Add(d.policy.ProbeInterval)
+			health.CircuitOpen = true
+			health.NextProbeAt = &next
+			opened = true
+		}
+
+		if d.policy.DisableAfter > 0 && health.DisabledAt == nil && now.Sub(*health.FailingSince) >= d.policy.DisableAfter {
+			disabledAt := now
+			health.DisabledAt = &disabledAt
+			disable = true
+		}
+		return true
+	})
+	if updateErr != nil {
+		fmt.Println("error updating subscription health:", id, updateErr)
+		return
+	}
+
+	if closed {
+		fmt.Println("closing circuit for subscription:", id)
+	}
+	if opened {
+		fmt.Println("opening circuit for subscription:", id)
+		metrics.CircuitsOpened.Add(1)
+	}
+	if disable {
+		d.disable(id, now)
+	}
+}
+
+func (d *Dispatcher) disable(id string, now time.Time) {
+	fmt.Println("disabling failing subscription:", id)
+	metrics.SubscriptionsDisabled.Add(1)
+	if err := d.store.DisableSubscription(id, now); err != nil {
+		fmt.Println("error disabling subscription:", id, err)
+	}
+}
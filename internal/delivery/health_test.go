@@ -0,0 +1,187 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/baely/balance/internal/database"
+	"github.com/baely/balance/pkg/model"
+)
+
+var errFailed = errors.New("subscriber failed")
+
+func healthDispatcher(t *testing.T, policy Policy) (*Dispatcher, database.Store) {
+	t.Helper()
+
+	store := database.NewMemoryClient()
+	if err := store.AddSubscription(model.Subscription{Id: "sub_1", Uri: "https://example.com", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	policy.MaxAttempts = 8
+	policy.BaseDelay = time.Millisecond
+	policy.MaxDelay = time.Millisecond
+	return NewDispatcher(store, policy, Limits{Concurrency: 4, Timeout: time.Second, FirstAttemptWait: time.Second, AllowPrivateNetworks: true}), store
+}
+
+func health(t *testing.T, store database.Store) model.SubscriptionHealth {
+	t.Helper()
+
+	subscription, err := store.GetSubscription("sub_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return subscription.Health
+}
+
+func TestCircuitOpens(t *testing.T) {
+	var calls atomic.Int32
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer subscriber.Close()
+
+	d, store := healthDispatcher(t, Policy{FailureThreshold: 2, ProbeInterval: time.Minute})
+	subscription, err := store.GetSubscription("sub_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscription.Uri = subscriber.URL
+	if err := store.UpdateSubscription(subscription); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, eventId := range []string{"evt_1", "evt_2"} {
+		if err := d.Deliver(ctx, eventId, []Target{{Subscription: subscription, Payload: Payload{Body: []byte("{}")}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := health(t, store)
+	if !h.CircuitOpen || h.ConsecutiveFailures != 2 || h.NextProbeAt == nil || h.FailingSince == nil {
+		t.Fatalf("health = %+v, want an open circuit after 2 failures", h)
+	}
+
+	// Held back until the probe without being sent
+	if err := d.Deliver(ctx, "evt_3", []Target{{Subscription: subscription, Payload: Payload{Body: []byte("{}")}}}); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("subscriber called %d times, want 2", n)
+	}
+	held, err := store.GetEventDelivery("sub_1", "evt_3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if held.Attempts != 0 || !held.NextAttemptAt.Equal(*h.NextProbeAt) {
+		t.Errorf("held delivery has %d attempts and is due at %v, want none and %v", held.Attempts, held.NextAttemptAt, *h.NextProbeAt)
+	}
+}
+
+func TestCircuitProbe(t *testing.T) {
+	d, store := healthDispatcher(t, Policy{FailureThreshold: 1, ProbeInterval: time.Minute})
+
+	now := time.Now()
+	d.recordHealth("sub_1", errFailed, now.Add(-2*time.Minute))
+	subscription, err := store.GetSubscription("sub_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deliveries held back until the same probe time come due together, and
+	// only one of them is let through
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, until := d.allow(subscription, now)
+			if ok {
+				allowed.Add(1)
+			} else if !until.Equal(now.Add(time.Minute)) {
+				t.Errorf("held back until %v, want %v", until, now.Add(time.Minute))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := allowed.Load(); n != 1 {
+		t.Errorf("%d probes let through, want 1", n)
+	}
+
+	// A successful probe closes the circuit
+	d.recordHealth("sub_1", nil, now)
+	if h := health(t, store); h != (model.SubscriptionHealth{}) {
+		t.Errorf("health = %+v after a successful probe, want a clean bill", h)
+	}
+}
+
+func TestRecordHealthConcurrentFailures(t *testing.T) {
+	d, store := healthDispatcher(t, Policy{FailureThreshold: 100, ProbeInterval: time.Minute})
+
+	now := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.recordHealth("sub_1", errFailed, now)
+		}()
+	}
+	wg.Wait()
+
+	if h := health(t, store); h.ConsecutiveFailures != 20 {
+		t.Errorf("consecutive failures = %d, want 20", h.ConsecutiveFailures)
+	}
+}
+
+func TestAutoDisable(t *testing.T) {
+	d, store := healthDispatcher(t, Policy{FailureThreshold: 5, ProbeInterval: time.Minute, DisableAfter: time.Hour})
+
+	now := time.Now()
+	d.recordHealth("sub_1", errFailed, now.Add(-2*time.Hour))
+
+	// Changed through the API since the subscription was last read
+	subscription, err := store.GetSubscription("sub_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !subscription.Enabled {
+		t.Fatal("subscription disabled after its first failure")
+	}
+	subscription.Description = "renamed"
+	if err := store.UpdateSubscription(subscription); err != nil {
+		t.Fatal(err)
+	}
+
+	d.recordHealth("sub_1", errFailed, now)
+
+	subscription, err = store.GetSubscription("sub_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subscription.Enabled || subscription.Health.DisabledAt == nil {
+		t.Errorf("subscription is enabled %v with health %+v, want disabled", subscription.Enabled, subscription.Health)
+	}
+	if subscription.Description != "renamed" {
+		t.Errorf("description = %q, want the update kept", subscription.Description)
+	}
+
+	// Later deliveries become dead letters
+	delivery, err := d.create("evt_1", subscription, Payload{Body: []byte("{}")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery = d.attempt(context.Background(), delivery); delivery.Status != model.DeliveryDead {
+		t.Errorf("delivery is %s, want dead", delivery.Status)
+	}
+}
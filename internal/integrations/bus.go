@@ -0,0 +1,130 @@
+package integrations
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	WebhookEventsTopic = getEnv("WEBHOOK_EVENTS_TOPIC", "webhook-events")
+	TransactionsTopic  = getEnv("TRANSACTIONS_TOPIC", "transactions")
+)
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// Publisher publishes messages to a named topic.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, data []byte) (string, error)
+	Close()
+}
+
+// Subscriber receives messages published to a topic. The subscription names
+// the consumer so that several processes can share the work of one topic.
+// The returned channel is closed once ctx is done or the subscription fails.
+type Subscriber interface {
+	Subscribe(ctx context.Context, topic, subscription string) (<-chan *Message, error)
+}
+
+// Bus is a message bus driver.
+type Bus interface {
+	Publisher
+	Subscriber
+}
+
+// Message is a message received from a topic. Exactly one of Ack or Nack
+// should be called once the message has been handled.
+type Message struct {
+	ID   string
+	Data []byte
+
+	ack  func()
+	nack func()
+}
+
+func (m *Message) Ack() {
+	if m.ack != nil {
+		m.ack()
+	}
+}
+
+func (m *Message) Nack() {
+	if m.nack != nil {
+		m.nack()
+	}
+}
+
+// GetBus returns the Bus configured by BUS_DRIVER. Google Pub/Sub is used by
+// default.
+func GetBus() (Bus, error) {
+	switch driver := os.Getenv("BUS_DRIVER"); driver {
+	case "", "pubsub":
+		return NewPubSubClient(os.Getenv("GCP_PROJECT"))
+	case "nats":
+		limits, err := natsLimitsFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return NewNatsClient(os.Getenv("NATS_URL"), getEnv("NATS_STREAM", "BALANCE"), limits)
+	case "redis":
+		limits, err := redisLimitsFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return NewRedisClient(os.Getenv("REDIS_URL"), limits)
+	case "memory":
+		return NewMemoryBus(), nil
+	default:
+		return nil, fmt.Errorf("unknown bus driver: %q", driver)
+	}
+}
+
+// natsLimitsFromEnv reads NATS_MAX_DELIVER, NATS_MAX_AGE and NATS_MAX_MSGS.
+func natsLimitsFromEnv() (NatsLimits, error) {
+	maxDeliver, err := strconv.Atoi(getEnv("NATS_MAX_DELIVER", "10"))
+	if err != nil || maxDeliver < 1 {
+		return NatsLimits{}, fmt.Errorf("invalid NATS_MAX_DELIVER: %q", os.Getenv("NATS_MAX_DELIVER"))
+	}
+
+	maxAge, err := time.ParseDuration(getEnv("NATS_MAX_AGE", "168h"))
+	if err != nil || maxAge <= 0 {
+		return NatsLimits{}, fmt.Errorf("invalid NATS_MAX_AGE: %q", os.Getenv("NATS_MAX_AGE"))
+	}
+
+	maxMsgs, err := strconv.ParseInt(getEnv("NATS_MAX_MSGS", "1000000"), 10, 64)
+	if err != nil || maxMsgs < 1 {
+		return NatsLimits{}, fmt.Errorf("invalid NATS_MAX_MSGS: %q", os.Getenv("NATS_MAX_MSGS"))
+	}
+
+	return NatsLimits{MaxDeliver: maxDeliver, MaxAge: maxAge, MaxMsgs: maxMsgs}, nil
+}
+
+// redisLimitsFromEnv reads REDIS_CLAIM_IDLE, REDIS_MAX_DELIVER and
+// REDIS_MAX_LEN.
+func redisLimitsFromEnv() (RedisLimits, error) {
+	// Reads block for at most ClaimIdle, and reclaiming messages idle for no
+	// time at all would take them from consumers still handling them
+	claimIdle, err := time.ParseDuration(getEnv("REDIS_CLAIM_IDLE", "1m"))
+	if err != nil || claimIdle <= 0 {
+		return RedisLimits{}, fmt.Errorf("invalid REDIS_CLAIM_IDLE: %q", os.Getenv("REDIS_CLAIM_IDLE"))
+	}
+
+	maxDeliver, err := strconv.ParseInt(getEnv("REDIS_MAX_DELIVER", "10"), 10, 64)
+	if err != nil || maxDeliver < 1 {
+		return RedisLimits{}, fmt.Errorf("invalid REDIS_MAX_DELIVER: %q", os.Getenv("REDIS_MAX_DELIVER"))
+	}
+
+	maxLen, err := strconv.ParseInt(getEnv("REDIS_MAX_LEN", "1000000"), 10, 64)
+	if err != nil || maxLen < 1 {
+		return RedisLimits{}, fmt.Errorf("invalid REDIS_MAX_LEN: %q", os.Getenv("REDIS_MAX_LEN"))
+	}
+
+	return RedisLimits{ClaimIdle: claimIdle, MaxDeliver: maxDeliver, MaxLen: maxLen}, nil
+}
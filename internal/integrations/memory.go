@@ -0,0 +1,91 @@
+package integrations
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const memoryRedeliveryDelay = 5 * time.Second
+
+// MemoryBus delivers messages in-process. Messages published to a topic
+// without a subscriber are dropped, and nacked messages are redelivered after
+// a short delay.
+type MemoryBus struct {
+	mu     sync.Mutex
+	topics map[string]chan *Message
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		topics: make(map[string]chan *Message),
+	}
+}
+
+func (b *MemoryBus) Close() {}
+
+func (b *MemoryBus) Publish(ctx context.Context, topic string, data []byte) (string, error) {
+	b.mu.Lock()
+	ch, ok := b.topics[topic]
+	b.mu.Unlock()
+
+	id := uuid.NewString()
+
+	if !ok {
+		fmt.Println("no subscribers for topic, dropping message:", topic, id)
+		return id, nil
+	}
+
+	msg := &Message{
+		ID:   id,
+		Data: data,
+	}
+	msg.nack = func() {
+		time.AfterFunc(memoryRedeliveryDelay, func() {
+			ch <- msg
+		})
+	}
+
+	select {
+	case ch <- msg:
+		return id, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Subscribe delivers messages published to topic. All subscriptions to a
+// topic share its messages.
+func (b *MemoryBus) Subscribe(ctx context.Context, topic, _ string) (<-chan *Message, error) {
+	b.mu.Lock()
+	in, ok := b.topics[topic]
+	if !ok {
+		in = make(chan *Message, 1024)
+		b.topics[topic] = in
+	}
+	b.mu.Unlock()
+
+	ch := make(chan *Message)
+	go func() {
+		defer close(ch)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg := <-in:
+				select {
+				case ch <- msg:
+				case <-ctx.Done():
+					msg.Nack()
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,169 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsBackOff is how long a message waits before each redelivery. The last
+// delay repeats until the consumer's MaxDeliver is reached.
+var natsBackOff = []time.Duration{5 * time.Second, 30 * time.Second, 2 * time.Minute, 10 * time.Minute, 30 * time.Minute}
+
+// NatsLimits bounds redeliveries and the size of the stream.
+type NatsLimits struct {
+	// MaxDeliver is how many times a message is delivered before it is
+	// given up on.
+	MaxDeliver int
+
+	// MaxAge and MaxMsgs limit the stream. The oldest messages are discarded
+	// first.
+	MaxAge  time.Duration
+	MaxMsgs int64
+}
+
+// NatsClient is the NATS JetStream backed Bus. Each topic is a subject on a
+// single stream, and each subscription is a durable consumer on that stream.
+type NatsClient struct {
+	conn   *nats.Conn
+	js     jetstream.JetStream
+	stream string
+	limits NatsLimits
+}
+
+func NewNatsClient(url, stream string, limits NatsLimits) (*NatsClient, error) {
+	if url == "" {
+		url = nats.DefaultURL
+	}
+
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	_, err = js.CreateOrUpdateStream(context.Background(), jetstream.StreamConfig{
+		Name:     stream,
+		Subjects: []string{WebhookEventsTopic, TransactionsTopic},
+		MaxAge:   limits.MaxAge,
+		MaxMsgs:  limits.MaxMsgs,
+		Discard:  jetstream.DiscardOld,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &NatsClient{
+		conn:   conn,
+		js:     js,
+		stream: stream,
+		limits: limits,
+	}, nil
+}
+
+func (c *NatsClient) Close() {
+	c.conn.Close()
+}
+
+func (c *NatsClient) Publish(ctx context.Context, topic string, data []byte) (string, error) {
+	id := uuid.NewString()
+
+	_, err := c.js.Publish(ctx, topic, data, jetstream.WithMsgID(id))
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (c *NatsClient) Subscribe(ctx context.Context, topic, subscription string) (<-chan *Message, error) {
+	consumer, err := c.js.CreateOrUpdateConsumer(ctx, c.stream, jetstream.ConsumerConfig{
+		Durable:       subscription,
+		FilterSubject: topic,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		MaxDeliver:    c.limits.MaxDeliver,
+		// BackOff replaces AckWait for messages that are never acked, such
+		// as those of a crashed worker
+		BackOff: natsBackOff[:min(len(natsBackOff), c.limits.MaxDeliver-1)],
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	iter, err := consumer.Messages()
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		<-ctx.Done()
+		iter.Stop()
+	}()
+
+	ch := make(chan *Message)
+	go func() {
+		defer close(ch)
+
+		for {
+			m, err := iter.Next()
+			if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+				return
+			}
+			if err != nil {
+				// Wait out the error rather than spinning on it
+				fmt.Println("nats receive error:", err)
+				select {
+				case <-time.After(time.Second):
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			msg := &Message{
+				ID:   m.Headers().Get(jetstream.MsgIDHeader),
+				Data: m.Data(),
+				ack: func() {
+					if err := m.Ack(); err != nil {
+						fmt.Println("nats ack error:", err)
+					}
+				},
+				nack: func() {
+					if err := m.NakWithDelay(natsDelay(m)); err != nil {
+						fmt.Println("nats nack error:", err)
+					}
+				},
+			}
+
+			select {
+			case ch <- msg:
+			case <-ctx.Done():
+				m.Nak()
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// natsDelay returns how long a nacked message waits before it is redelivered.
+func natsDelay(m jetstream.Msg) time.Duration {
+	attempt := 1
+	if meta, err := m.Metadata(); err == nil {
+		attempt = int(meta.NumDelivered)
+	}
+
+	return natsBackOff[min(max(attempt, 1), len(natsBackOff))-1]
+}
@@ -2,17 +2,70 @@ package integrations
 
 import (
 	"context"
-	"os"
+	"fmt"
 
 	"cloud.google.com/go/pubsub"
+	"github.com/google/uuid"
 )
 
-func GetClient() *pubsub.Client {
+// PubSubClient is the Google Pub/Sub backed Bus. Topics and subscriptions
+// are expected to already exist.
+type PubSubClient struct {
+	client *pubsub.Client
+}
+
+func NewPubSubClient(projectId string) (*PubSubClient, error) {
 	ctx := context.Background()
-	client, err := pubsub.NewClient(ctx, os.Getenv("GCP_PROJECT"))
+	client, err := pubsub.NewClient(ctx, projectId)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
-	return client
+	return &PubSubClient{
+		client: client,
+	}, nil
+}
+
+func (c *PubSubClient) Close() {
+	c.client.Close()
+}
+
+func (c *PubSubClient) Publish(ctx context.Context, topic string, data []byte) (string, error) {
+	res := c.client.Topic(topic).Publish(ctx, &pubsub.Message{
+		ID:   uuid.NewString(),
+		Data: data,
+	})
+
+	return res.Get(ctx)
+}
+
+// Subscribe receives from the named Pub/Sub subscription. The subscription
+// is already bound to its topic, so topic is unused.
+func (c *PubSubClient) Subscribe(ctx context.Context, _, subscription string) (<-chan *Message, error) {
+	sub := c.client.Subscription(subscription)
+
+	ch := make(chan *Message)
+	go func() {
+		defer close(ch)
+
+		err := sub.Receive(ctx, func(ctx context.Context, m *pubsub.Message) {
+			msg := &Message{
+				ID:   m.ID,
+				Data: m.Data,
+				ack:  m.Ack,
+				nack: m.Nack,
+			}
+
+			select {
+			case ch <- msg:
+			case <-ctx.Done():
+				m.Nack()
+			}
+		})
+		if err != nil {
+			fmt.Println("pubsub receive error:", err)
+		}
+	}()
+
+	return ch, nil
 }
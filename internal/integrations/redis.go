@@ -0,0 +1,241 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisReadCount = 10
+	redisReadBlock = 5 * time.Second
+)
+
+// RedisLimits bounds redeliveries and the size of each stream.
+type RedisLimits struct {
+	// ClaimIdle is how long a message stays pending before it is redelivered.
+	ClaimIdle time.Duration
+
+	// MaxDeliver is how many times a message is delivered before it is moved
+	// to the topic's dead letter stream.
+	MaxDeliver int64
+
+	// MaxLen is the approximate number of entries kept in a stream. Trimming
+	// does not look at consumer groups, so a backlog longer than MaxLen loses
+	// its oldest messages, even ones still pending.
+	MaxLen int64
+}
+
+// RedisClient is the Redis Streams backed Bus. Each topic is a stream and
+// each subscription is a consumer group on that stream.
+//
+// Redis has no negative acknowledgement, so a nacked message stays pending
+// until it has been idle for ClaimIdle, at which point any consumer in the
+// group reclaims and redelivers it. Messages left pending by a crashed
+// consumer are recovered the same way. Messages delivered MaxDeliver times are
+// acked and copied to the "<topic>-dead-letters" stream instead.
+type RedisClient struct {
+	client   *redis.Client
+	consumer string
+	limits   RedisLimits
+}
+
+func NewRedisClient(url string, limits RedisLimits) (*RedisClient, error) {
+	if url == "" {
+		url = "redis://localhost:6379"
+	}
+
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+
+	return &RedisClient{
+		client:   client,
+		consumer: fmt.Sprintf("%s-%s", hostname, uuid.NewString()),
+		limits:   limits,
+	}, nil
+}
+
+func (c *RedisClient) Close() {
+	c.client.Close()
+}
+
+func (c *RedisClient) Publish(ctx context.Context, topic string, data []byte) (string, error) {
+	id := uuid.NewString()
+
+	if err := c.add(ctx, topic, id, data); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (c *RedisClient) add(ctx context.Context, stream, id string, data any) error {
+	return c.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: c.limits.MaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"id":   id,
+			"data": data,
+		},
+	}).Err()
+}
+
+func (c *RedisClient) Subscribe(ctx context.Context, topic, subscription string) (<-chan *Message, error) {
+	err := c.client.XGroupCreateMkStream(ctx, topic, subscription, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, err
+	}
+
+	// Wake up at least as often as pending messages become claimable
+	block := min(redisReadBlock, c.limits.ClaimIdle)
+
+	ch := make(chan *Message)
+	go func() {
+		defer close(ch)
+
+		lastClaim := time.Time{}
+		claimStart := "0-0"
+		for ctx.Err() == nil {
+			var msgs []redis.XMessage
+
+			if time.Since(lastClaim) >= c.limits.ClaimIdle {
+				claimed, next, err := c.reclaim(ctx, topic, subscription, claimStart)
+				if err != nil {
+					fmt.Println("redis reclaim error:", err)
+				}
+				msgs = append(msgs, claimed...)
+
+				// Pick up where this pass stopped, and wait for the next
+				// interval once every pending message has been looked at
+				claimStart = next
+				if next == "0-0" {
+					lastClaim = time.Now()
+				}
+			}
+
+			streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+				Group:    subscription,
+				Consumer: c.consumer,
+				Streams:  []string{topic, ">"},
+				Count:    redisReadCount,
+				Block:    block,
+			}).Result()
+			if err != nil && !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				fmt.Println("redis read error:", err)
+				time.Sleep(time.Second)
+			}
+			for _, stream := range streams {
+				msgs = append(msgs, stream.Messages...)
+			}
+
+			for _, m := range msgs {
+				select {
+				case ch <- c.message(topic, subscription, m):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// reclaim takes ownership of up to redisReadCount messages from start that
+// have been pending in the group for longer than ClaimIdle. It returns the
+// messages to redeliver and where the next pass starts, which is "0-0" once
+// the end of the pending list is reached. Messages that have been delivered
+// MaxDeliver times are dead lettered rather than returned.
+func (c *RedisClient) reclaim(ctx context.Context, topic, subscription, start string) ([]redis.XMessage, string, error) {
+	claimed, next, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   topic,
+		Group:    subscription,
+		Consumer: c.consumer,
+		MinIdle:  c.limits.ClaimIdle,
+		Start:    start,
+		Count:    redisReadCount,
+	}).Result()
+	if err != nil {
+		return nil, "0-0", err
+	}
+
+	var msgs []redis.XMessage
+	for _, m := range claimed {
+		// Entries trimmed from the stream while pending have no values
+		if len(m.Values) == 0 {
+			c.ack(topic, subscription, m.ID)
+			continue
+		}
+
+		pending, err := c.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: topic,
+			Group:  subscription,
+			Start:  m.ID,
+			End:    m.ID,
+			Count:  1,
+		}).Result()
+		if err != nil {
+			return msgs, next, err
+		}
+
+		if len(pending) == 1 && pending[0].RetryCount > c.limits.MaxDeliver {
+			c.deadLetter(ctx, topic, subscription, m, pending[0].RetryCount-1)
+			continue
+		}
+
+		msgs = append(msgs, m)
+	}
+
+	return msgs, next, nil
+}
+
+// deadLetter moves a message that keeps failing to the topic's dead letter
+// stream, so that it stops being redelivered but can still be inspected.
+func (c *RedisClient) deadLetter(ctx context.Context, topic, subscription string, m redis.XMessage, deliveries int64) {
+	id, _ := m.Values["id"].(string)
+	fmt.Println("redis message failed, moving to dead letters:", id, "deliveries:", deliveries)
+
+	if err := c.add(ctx, topic+"-dead-letters", id, m.Values["data"]); err != nil {
+		// Left pending, to be tried again on the next pass
+		fmt.Println("redis dead letter error:", err)
+		return
+	}
+
+	c.ack(topic, subscription, m.ID)
+}
+
+func (c *RedisClient) ack(topic, subscription, id string) {
+	if err := c.client.XAck(context.Background(), topic, subscription, id).Err(); err != nil {
+		fmt.Println("redis ack error:", err)
+	}
+}
+
+func (c *RedisClient) message(topic, subscription string, m redis.XMessage) *Message {
+	id, _ := m.Values["id"].(string)
+	data, _ := m.Values["data"].(string)
+
+	return &Message{
+		ID:   id,
+		Data: []byte(data),
+		ack: func() {
+			c.ack(topic, subscription, m.ID)
+		},
+	}
+}
@@ -0,0 +1,94 @@
+package integrations
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/baely/balance/internal/metrics"
+	"github.com/baely/balance/pkg/model"
+	"github.com/baely/balance/pkg/up"
+)
+
+// UpCache sits in front of the Up client to save a request per event for
+// categories, which rarely change. Accounts are not cached: every event needs
+// the live balance, and Up only returns it with the rest of the account.
+type UpCache struct {
+	client *up.Client
+	ttl    time.Duration
+
+	mu                  sync.Mutex
+	categories          map[string]model.CategoryResource
+	categoriesFetchedAt time.Time
+
+	// unknown holds when category IDs were found to be missing, so that each
+	// only refreshes the list once per ttl
+	unknown map[string]time.Time
+}
+
+// NewUpCache caches lookups for UP_CACHE_TTL, defaulting to 10 minutes.
+func NewUpCache(client *up.Client) *UpCache {
+	ttl, err := time.ParseDuration(os.Getenv("UP_CACHE_TTL"))
+	if err != nil {
+		ttl = 10 * time.Minute
+	}
+
+	return &UpCache{
+		client:  client,
+		ttl:     ttl,
+		unknown: make(map[string]time.Time),
+	}
+}
+
+// Category returns a category. Every category is fetched at once, and again
+// when the cache expires or a category is missing from it. A category that is
+// still missing is remembered as unknown until the cache expires.
+func (c *UpCache) Category(ctx context.Context, categoryId string) (model.CategoryResource, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	category, ok := c.categories[categoryId]
+	fresh := now.Sub(c.categoriesFetchedAt) < c.ttl
+	missingAt, missing := c.unknown[categoryId]
+	c.mu.Unlock()
+
+	if ok && fresh {
+		metrics.UpCacheHits.Add("categories", 1)
+		return category, nil
+	}
+	if missing && now.Sub(missingAt) < c.ttl {
+		metrics.UpCacheHits.Add("categories", 1)
+		return model.CategoryResource{}, fmt.Errorf("unknown category: %s", categoryId)
+	}
+	metrics.UpCacheMisses.Add("categories", 1)
+
+	list, err := c.client.ListCategories(ctx, nil)
+	if err != nil {
+		return model.CategoryResource{}, err
+	}
+
+	categories := make(map[string]model.CategoryResource, len(list))
+	for _, category := range list {
+		categories[category.Id] = category
+	}
+
+	category, ok = categories[categoryId]
+
+	c.mu.Lock()
+	c.categories = categories
+	c.categoriesFetchedAt = now
+	if ok {
+		delete(c.unknown, categoryId)
+	} else {
+		c.unknown[categoryId] = now
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return model.CategoryResource{}, fmt.Errorf("unknown category: %s", categoryId)
+	}
+
+	return category, nil
+}
@@ -0,0 +1,110 @@
+package integrations
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/baely/balance/pkg/up"
+	"github.com/baely/balance/pkg/up/uptest"
+)
+
+// countingServer serves a fake Up API and counts category list requests.
+func countingServer(t *testing.T) (*up.Client, func() int64) {
+	t.Helper()
+
+	fake := uptest.New(uptest.DefaultFixtures())
+
+	var n atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/v1/categories") {
+			n.Add(1)
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := up.NewClient("up:yeah:test", up.WithBaseURL(srv.URL+"/api/v1/"))
+	return client, n.Load
+}
+
+func TestUpCacheCategory(t *testing.T) {
+	t.Setenv("UP_CACHE_TTL", "1h")
+
+	client, requests := countingServer(t)
+	cache := NewUpCache(client)
+	ctx := context.Background()
+
+	for _, id := range []string{"restaurants-and-cafes", "good-life", "groceries", "good-life"} {
+		category, err := cache.Category(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if category.Id != id {
+			t.Errorf("category = %s, want %s", category.Id, id)
+		}
+	}
+	if n := requests(); n != 1 {
+		t.Errorf("listed categories %d times, want 1", n)
+	}
+}
+
+func TestUpCacheUnknownCategory(t *testing.T) {
+	t.Setenv("UP_CACHE_TTL", "1h")
+
+	client, requests := countingServer(t)
+	cache := NewUpCache(client)
+	ctx := context.Background()
+
+	if _, err := cache.Category(ctx, "home"); err != nil {
+		t.Fatal(err)
+	}
+
+	// An unknown category refreshes the list once in case it is new, and is
+	// then remembered as unknown
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Category(ctx, "missing"); err == nil {
+			t.Fatal("Category() of an unknown category succeeded")
+		}
+	}
+	if n := requests(); n != 2 {
+		t.Errorf("listed categories %d times, want 2", n)
+	}
+
+	// Another unknown category gets its own refresh, without undoing the
+	// first
+	for _, id := range []string{"also-missing", "missing", "also-missing"} {
+		if _, err := cache.Category(ctx, id); err == nil {
+			t.Fatalf("Category(%s) of an unknown category succeeded", id)
+		}
+	}
+	if n := requests(); n != 3 {
+		t.Errorf("listed categories %d times, want 3", n)
+	}
+
+	// Known categories are still served from the cache
+	if _, err := cache.Category(ctx, "groceries"); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests(); n != 3 {
+		t.Errorf("listed categories %d times, want 3", n)
+	}
+}
+
+func TestUpCacheTTL(t *testing.T) {
+	t.Setenv("UP_CACHE_TTL", "0s")
+
+	client, requests := countingServer(t)
+	cache := NewUpCache(client)
+	ctx := context.Background()
+
+	for _, id := range []string{"home", "home", "missing", "missing"} {
+		cache.Category(ctx, id)
+	}
+	if n := requests(); n != 4 {
+		t.Errorf("listed categories %d times, want 4", n)
+	}
+}
@@ -0,0 +1,33 @@
+// Package metrics holds the service counters. They are published through
+// expvar and served on /debug/vars.
+package metrics
+
+import "expvar"
+
+var (
+	// StaleBalanceWrites counts balance updates rejected because a newer
+	// balance was already stored.
+	StaleBalanceWrites = expvar.NewInt("stale_balance_writes")
+
+	// DuplicateEvents counts webhook events skipped because they had already
+	// been processed.
+	DuplicateEvents = expvar.NewInt("duplicate_events")
+
+	// DeliveryAttempts and DeliveryFailures count outbound webhook requests.
+	DeliveryAttempts = expvar.NewInt("delivery_attempts")
+	DeliveryFailures = expvar.NewInt("delivery_failures")
+
+	// DeadLetters counts deliveries that exhausted their attempts or whose
+	// subscription was disabled or deleted.
+	DeadLetters = expvar.NewInt("dead_letters")
+
+	// CircuitsOpened counts subscribers cut off after repeated failures, and
+	// SubscriptionsDisabled those disabled for failing too long.
+	CircuitsOpened        = expvar.NewInt("circuits_opened")
+	SubscriptionsDisabled = expvar.NewInt("subscriptions_disabled")
+
+	// UpCacheHits and UpCacheMisses count cached Up lookups, keyed by the
+	// kind of resource, such as "categories".
+	UpCacheHits   = expvar.NewMap("up_cache_hits")
+	UpCacheMisses = expvar.NewMap("up_cache_misses")
+)
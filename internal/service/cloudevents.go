@@ -0,0 +1,69 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+const (
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsContentType = "application/cloudevents+json"
+	cloudEventTypePrefix   = "au.com.up."
+)
+
+// CloudEventType maps an Up event type such as TRANSACTION_CREATED to a
+// CloudEvent type such as au.com.up.transaction.created.
+func CloudEventType(eventType string) string {
+	return cloudEventTypePrefix + strings.ReplaceAll(strings.ToLower(eventType), "_", ".")
+}
+
+// NewCloudEvent wraps the RawWebhookEvent of an Up event. The Up webhook
+// event ID is the CloudEvent ID, so receivers can deduplicate on it.
+func NewCloudEvent(source string, event EventData) (model.CloudEvent, error) {
+	data, err := RawWebhookEventPayload(event.Account, event.Transaction)
+	if err != nil {
+		return model.CloudEvent{}, err
+	}
+
+	return model.CloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		Type:            CloudEventType(event.EventType),
+		Source:          source,
+		Id:              event.EventId,
+		Time:            event.EventCreatedAt,
+		Subject:         event.Transaction.Id,
+		DataContentType: defaultContentType,
+		Data:            data,
+	}, nil
+}
+
+// CloudEventPayload renders a CloudEvent in structured or binary HTTP mode,
+// returning the body, content type and any headers to send.
+func CloudEventPayload(e model.CloudEvent, format model.SubscriptionFormat) ([]byte, string, map[string]string, error) {
+	switch format {
+	case model.FormatCloudEvents:
+		body, err := json.Marshal(e)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return body, cloudEventsContentType, nil, nil
+	case model.FormatCloudEventsBinary:
+		headers := map[string]string{
+			"ce-specversion": e.SpecVersion,
+			"ce-type":        e.Type,
+			"ce-source":      e.Source,
+			"ce-id":          e.Id,
+			"ce-time":        e.Time.Format(time.RFC3339Nano),
+		}
+		if e.Subject != "" {
+			headers["ce-subject"] = e.Subject
+		}
+		return e.Data, e.DataContentType, headers, nil
+	default:
+		return nil, "", nil, fmt.Errorf("unknown cloudevents format: %q", format)
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+func TestCloudEventType(t *testing.T) {
+	for eventType, want := range map[string]string{
+		"TRANSACTION_CREATED": "au.com.up.transaction.created",
+		"TRANSACTION_SETTLED": "au.com.up.transaction.settled",
+		"PING":                "au.com.up.ping",
+	} {
+		if got := CloudEventType(eventType); got != want {
+			t.Errorf("CloudEventType(%s) = %s, want %s", eventType, got, want)
+		}
+	}
+}
+
+func TestCloudEventPayload(t *testing.T) {
+	event := templateEvent(t)
+	event.EventCreatedAt = time.Date(2024, time.May, 20, 8, 15, 1, 0, time.UTC)
+
+	e, err := NewCloudEvent("/balance", event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("structured", func(t *testing.T) {
+		body, contentType, headers, err := CloudEventPayload(e, model.FormatCloudEvents)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contentType != "application/cloudevents+json" {
+			t.Errorf("content type = %s, want application/cloudevents+json", contentType)
+		}
+		if len(headers) != 0 {
+			t.Errorf("headers = %v, want none", headers)
+		}
+
+		var got struct {
+			SpecVersion     string                `json:"specversion"`
+			Type            string                `json:"type"`
+			Source          string                `json:"source"`
+			Id              string                `json:"id"`
+			Time            time.Time             `json:"time"`
+			Subject         string                `json:"subject"`
+			DataContentType string                `json:"datacontenttype"`
+			Data            model.RawWebhookEvent `json:"data"`
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if got.SpecVersion != "1.0" || got.Type != "au.com.up.transaction.created" || got.Source != "/balance" {
+			t.Errorf("got %s %s from %s, want 1.0 au.com.up.transaction.created from /balance", got.SpecVersion, got.Type, got.Source)
+		}
+		if got.Id != "evt_1" || got.Subject != event.Transaction.Id || !got.Time.Equal(event.EventCreatedAt) {
+			t.Errorf("got id %s, subject %s at %v, want evt_1, %s at %v", got.Id, got.Subject, got.Time, event.Transaction.Id, event.EventCreatedAt)
+		}
+		if got.DataContentType != "application/json" {
+			t.Errorf("datacontenttype = %s, want application/json", got.DataContentType)
+		}
+		if got.Data.Account.Id != event.Account.Id || got.Data.Transaction.Id != event.Transaction.Id {
+			t.Errorf("data holds account %s and transaction %s, want %s and %s", got.Data.Account.Id, got.Data.Transaction.Id, event.Account.Id, event.Transaction.Id)
+		}
+	})
+
+	t.Run("binary", func(t *testing.T) {
+		body, contentType, headers, err := CloudEventPayload(e, model.FormatCloudEventsBinary)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contentType != "application/json" {
+			t.Errorf("content type = %s, want application/json", contentType)
+		}
+
+		want := map[string]string{
+			"ce-specversion": "1.0",
+			"ce-type":        "au.com.up.transaction.created",
+			"ce-source":      "/balance",
+			"ce-id":          "evt_1",
+			"ce-time":        "2024-05-20T08:15:01Z",
+			"ce-subject":     event.Transaction.Id,
+		}
+		if len(headers) != len(want) {
+			t.Errorf("headers = %v, want %v", headers, want)
+		}
+		for k, v := range want {
+			if headers[k] != v {
+				t.Errorf("%s = %q, want %q", k, headers[k], v)
+			}
+		}
+
+		// The body is the data alone
+		var data model.RawWebhookEvent
+		if err := json.Unmarshal(body, &data); err != nil {
+			t.Fatal(err)
+		}
+		if data.Transaction.Id != event.Transaction.Id {
+			t.Errorf("transaction = %s, want %s", data.Transaction.Id, event.Transaction.Id)
+		}
+	})
+
+	if _, _, _, err := CloudEventPayload(e, "xml"); err == nil {
+		t.Error("CloudEventPayload() = nil for an unknown format, want an error")
+	}
+}
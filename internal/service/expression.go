@@ -0,0 +1,101 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+// expressionEnv is the shape expressions are checked against. Resources are
+// exposed with their Up API JSON field names, so
+// transaction.attributes.amount.valueInBaseUnits reads as it does in the API.
+var expressionEnv = map[string]any{
+	"account":     map[string]any{},
+	"transaction": map[string]any{},
+}
+
+// programs caches compiled expressions by source.
+var programs sync.Map
+
+// CompileExpression checks that an expression is valid and returns a boolean.
+func CompileExpression(expression string) (*vm.Program, error) {
+	if program, ok := programs.Load(expression); ok {
+		return program.(*vm.Program), nil
+	}
+
+	program, err := expr.Compile(expression, expr.Env(expressionEnv), expr.AsBool())
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression: %w", err)
+	}
+
+	// Fields of the untyped env are unknown when compiling, so AsBool cannot
+	// reject an expression like transaction.attributes.description. Run it
+	// against empty resources to catch those. Runtime errors are fine here,
+	// since empty resources have null relationships.
+	env, err := newExpressionEnv(model.AccountResource{}, model.TransactionResource{})
+	if err != nil {
+		return nil, err
+	}
+	if out, err := expr.Run(program, env); err == nil {
+		if _, ok := out.(bool); !ok {
+			return nil, fmt.Errorf("invalid expression: returns %T, not bool", out)
+		}
+	}
+
+	programs.Store(expression, program)
+	return program, nil
+}
+
+// matchExpression evaluates expression against account and transaction. An
+// expression that fails to run, such as by reading a field of a null
+// relationship, does not match.
+func matchExpression(expression string, account model.AccountResource, transaction model.TransactionResource) bool {
+	program, err := CompileExpression(expression)
+	if err != nil {
+		fmt.Println("error compiling expression:", err)
+		return false
+	}
+
+	env, err := newExpressionEnv(account, transaction)
+	if err != nil {
+		fmt.Println("error building expression env:", err)
+		return false
+	}
+
+	out, err := expr.Run(program, env)
+	if err != nil {
+		fmt.Println("error running expression:", err)
+		return false
+	}
+
+	matched, ok := out.(bool)
+	if !ok {
+		fmt.Println("expression did not return a bool:", expression)
+		return false
+	}
+
+	return matched
+}
+
+func newExpressionEnv(account model.AccountResource, transaction model.TransactionResource) (map[string]any, error) {
+	env := make(map[string]any, 2)
+	for name, resource := range map[string]any{"account": account, "transaction": transaction} {
+		b, err := json.Marshal(resource)
+		if err != nil {
+			return nil, err
+		}
+
+		var v map[string]any
+		if err := json.Unmarshal(b, &v); err != nil {
+			return nil, err
+		}
+		env[name] = v
+	}
+
+	return env, nil
+}
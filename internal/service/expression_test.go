@@ -0,0 +1,48 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+func TestCompileExpression(t *testing.T) {
+	tests := []struct {
+		expression string
+		wantErr    bool
+	}{
+		{expression: `transaction.attributes.amount.valueInBaseUnits < -5000`},
+		{expression: `account.attributes.displayName contains "Spending"`},
+		{expression: `true`},
+		{expression: `1 +`, wantErr: true},
+		{expression: `42`, wantErr: true},
+		// Not rejected by AsBool, since the env is untyped
+		{expression: `transaction.attributes.description`, wantErr: true},
+		{expression: `account.id`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			if _, err := CompileExpression(tt.expression); (err != nil) != tt.wantErr {
+				t.Errorf("CompileExpression() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchExpressionNonBool(t *testing.T) {
+	// Expressions that only turn out not to be boolean when run against a
+	// real event do not match rather than panicking
+	const expression = `transaction.attributes.rawText ?? true`
+	if _, err := CompileExpression(expression); err != nil {
+		t.Fatal(err)
+	}
+
+	rawText := "SEVEN SEAS CAFE"
+	var transaction model.TransactionResource
+	transaction.Attributes.RawText = &rawText
+
+	if matchExpression(expression, model.AccountResource{}, transaction) {
+		t.Error("matchExpression() = true, want false")
+	}
+}
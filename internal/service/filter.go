@@ -0,0 +1,136 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+// DefaultFilter is applied to subscriptions that do not set a filter. Summary
+// subscribers have only ever been sent new debits on transactional accounts.
+func DefaultFilter(subscriptionType model.SubscriptionType) model.SubscriptionFilter {
+	if subscriptionType == model.SubscriptionSummary {
+		return model.SubscriptionFilter{
+			EventTypes:   []string{"TRANSACTION_CREATED"},
+			AccountTypes: []string{"TRANSACTIONAL"},
+			Direction:    model.Debit,
+		}
+	}
+
+	return model.SubscriptionFilter{}
+}
+
+// SubscriptionFilter returns the filter a subscription's events are matched
+// against.
+func SubscriptionFilter(subscription model.Subscription) model.SubscriptionFilter {
+	if subscription.Filter == nil {
+		return DefaultFilter(subscription.Type)
+	}
+
+	return *subscription.Filter
+}
+
+func ValidateFilter(filter model.SubscriptionFilter) error {
+	switch filter.Direction {
+	case "", model.Debit, model.Credit:
+	default:
+		return fmt.Errorf("invalid direction: %q", filter.Direction)
+	}
+
+	if (filter.MinAmount != nil && *filter.MinAmount < 0) || (filter.MaxAmount != nil && *filter.MaxAmount < 0) {
+		return errors.New("amounts must not be negative")
+	}
+
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+		return errors.New("min_amount is greater than max_amount")
+	}
+
+	if filter.Expression != "" {
+		if _, err := CompileExpression(filter.Expression); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MatchFilter reports whether an event about transaction on account passes
+// filter.
+func MatchFilter(filter model.SubscriptionFilter, eventType string, account model.AccountResource, transaction model.TransactionResource) bool {
+	if len(filter.EventTypes) > 0 && !slices.Contains(filter.EventTypes, eventType) {
+		return false
+	}
+
+	if len(filter.AccountIds) > 0 && !slices.Contains(filter.AccountIds, account.Id) {
+		return false
+	}
+
+	if len(filter.AccountTypes) > 0 && !slices.Contains(filter.AccountTypes, fmt.Sprint(account.Attributes.AccountType)) {
+		return false
+	}
+
+	amount := transaction.Attributes.Amount.ValueInBaseUnits
+
+	switch filter.Direction {
+	case model.Debit:
+		if amount >= 0 {
+			return false
+		}
+	case model.Credit:
+		if amount <= 0 {
+			return false
+		}
+	}
+
+	if amount < 0 {
+		amount = -amount
+	}
+	if filter.MinAmount != nil && amount < *filter.MinAmount {
+		return false
+	}
+	if filter.MaxAmount != nil && amount > *filter.MaxAmount {
+		return false
+	}
+
+	if len(filter.Categories) > 0 && !matchCategory(filter.Categories, transaction) {
+		return false
+	}
+
+	if len(filter.Tags) > 0 && !matchTag(filter.Tags, transaction) {
+		return false
+	}
+
+	if filter.ForeignOnly && transaction.Attributes.ForeignAmount == nil {
+		return false
+	}
+
+	if filter.Expression != "" && !matchExpression(filter.Expression, account, transaction) {
+		return false
+	}
+
+	return true
+}
+
+func matchCategory(categories []string, transaction model.TransactionResource) bool {
+	if category := transaction.Relationships.Category.Data; category != nil && slices.Contains(categories, category.Id) {
+		return true
+	}
+
+	if parent := transaction.Relationships.ParentCategory.Data; parent != nil && slices.Contains(categories, parent.Id) {
+		return true
+	}
+
+	return false
+}
+
+func matchTag(tags []string, transaction model.TransactionResource) bool {
+	for _, tag := range transaction.Relationships.Tags.Data {
+		if slices.Contains(tags, tag.Id) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/baely/balance/pkg/model"
+	"github.com/baely/balance/pkg/up/uptest"
+)
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestMatchFilter(t *testing.T) {
+	fixtures := uptest.DefaultFixtures()
+	spending, savings := fixtures.Accounts[0], fixtures.Accounts[1]
+	// A $10.56 cafe debit tagged Coffee, a $200 transfer credit and a
+	// foreign $2.59 debit tagged Holiday
+	cafe, transfer, metro := fixtures.Transactions[0], fixtures.Transactions[2], fixtures.Transactions[3]
+
+	tests := []struct {
+		name        string
+		filter      model.SubscriptionFilter
+		eventType   string
+		account     model.AccountResource
+		transaction model.TransactionResource
+		want        bool
+	}{
+		{
+			name:        "empty filter matches everything",
+			eventType:   "TRANSACTION_SETTLED",
+			account:     savings,
+			transaction: transfer,
+			want:        true,
+		},
+		{
+			name:        "summary default matches new debits",
+			filter:      DefaultFilter(model.SubscriptionSummary),
+			eventType:   "TRANSACTION_CREATED",
+			account:     spending,
+			transaction: cafe,
+			want:        true,
+		},
+		{
+			name:        "summary default skips settlements",
+			filter:      DefaultFilter(model.SubscriptionSummary),
+			eventType:   "TRANSACTION_SETTLED",
+			account:     spending,
+			transaction: cafe,
+		},
+		{
+			name:        "summary default skips savers",
+			filter:      DefaultFilter(model.SubscriptionSummary),
+			eventType:   "TRANSACTION_CREATED",
+			account:     savings,
+			transaction: transfer,
+		},
+		{
+			name:        "account ids",
+			filter:      model.SubscriptionFilter{AccountIds: []string{savings.Id}},
+			account:     spending,
+			transaction: cafe,
+		},
+		{
+			name:        "credit",
+			filter:      model.SubscriptionFilter{Direction: model.Credit},
+			account:     savings,
+			transaction: transfer,
+			want:        true,
+		},
+		{
+			name:        "debit skips credits",
+			filter:      model.SubscriptionFilter{Direction: model.Debit},
+			account:     savings,
+			transaction: transfer,
+		},
+		{
+			name:        "min amount is unsigned",
+			filter:      model.SubscriptionFilter{MinAmount: intPtr(1000)},
+			account:     spending,
+			transaction: cafe,
+			want:        true,
+		},
+		{
+			name:        "below min amount",
+			filter:      model.SubscriptionFilter{MinAmount: intPtr(1057)},
+			account:     spending,
+			transaction: cafe,
+		},
+		{
+			name:        "above max amount",
+			filter:      model.SubscriptionFilter{MaxAmount: intPtr(1055)},
+			account:     spending,
+			transaction: cafe,
+		},
+		{
+			name:        "parent category",
+			filter:      model.SubscriptionFilter{Categories: []string{"good-life"}},
+			account:     spending,
+			transaction: cafe,
+			want:        true,
+		},
+		{
+			name:        "uncategorised",
+			filter:      model.SubscriptionFilter{Categories: []string{"good-life"}},
+			account:     savings,
+			transaction: transfer,
+		},
+		{
+			name:        "tags",
+			filter:      model.SubscriptionFilter{Tags: []string{"Holiday", "Travel"}},
+			account:     spending,
+			transaction: metro,
+			want:        true,
+		},
+		{
+			name:        "foreign only",
+			filter:      model.SubscriptionFilter{ForeignOnly: true},
+			account:     spending,
+			transaction: cafe,
+		},
+		{
+			name:        "expression",
+			filter:      model.SubscriptionFilter{Expression: `transaction.attributes.foreignAmount.currencyCode == "JPY"`},
+			account:     spending,
+			transaction: metro,
+			want:        true,
+		},
+		{
+			name:        "expression reading a null field",
+			filter:      model.SubscriptionFilter{Expression: `transaction.attributes.foreignAmount.currencyCode == "JPY"`},
+			account:     spending,
+			transaction: cafe,
+		},
+		{
+			name: "every field must match",
+			filter: model.SubscriptionFilter{
+				AccountTypes: []string{"TRANSACTIONAL"},
+				Direction:    model.Debit,
+				Tags:         []string{"Coffee"},
+				ForeignOnly:  true,
+			},
+			account:     spending,
+			transaction: cafe,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchFilter(tt.filter, tt.eventType, tt.account, tt.transaction); got != tt.want {
+				t.Errorf("MatchFilter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  model.SubscriptionFilter
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "debit", filter: model.SubscriptionFilter{Direction: model.Debit}},
+		{name: "unknown direction", filter: model.SubscriptionFilter{Direction: "sideways"}, wantErr: true},
+		{name: "negative amount", filter: model.SubscriptionFilter{MinAmount: intPtr(-1)}, wantErr: true},
+		{name: "min above max", filter: model.SubscriptionFilter{MinAmount: intPtr(10), MaxAmount: intPtr(5)}, wantErr: true},
+		{name: "expression", filter: model.SubscriptionFilter{Expression: `account.attributes.accountType == "SAVER"`}},
+		{name: "invalid expression", filter: model.SubscriptionFilter{Expression: `account.attributes.accountType ==`}, wantErr: true},
+		{name: "non-bool expression", filter: model.SubscriptionFilter{Expression: `account.attributes.displayName`}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateFilter(tt.filter); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateFilter() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
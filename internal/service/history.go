@@ -0,0 +1,96 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+// MaxHistoryBuckets limits the size of a bucketed history response.
+const MaxHistoryBuckets = 1000
+
+type Interval string
+
+const (
+	Day   Interval = "day"
+	Week  Interval = "week"
+	Month Interval = "month"
+)
+
+func ParseInterval(s string) (Interval, error) {
+	switch i := Interval(s); i {
+	case Day, Week, Month:
+		return i, nil
+	default:
+		return "", fmt.Errorf("invalid interval: %q", s)
+	}
+}
+
+// truncate returns the start of the bucket containing t. Weeks start on
+// Monday.
+func (i Interval) truncate(t time.Time) time.Time {
+	y, m, d := t.Date()
+	switch i {
+	case Week:
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, t.Location())
+	case Month:
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	}
+}
+
+func (i Interval) next(t time.Time) time.Time {
+	switch i {
+	case Week:
+		return t.AddDate(0, 0, 7)
+	case Month:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// BucketBalanceHistory returns the closing balance of each interval between
+// from and to, with bucket boundaries in loc. opening is the balance in effect
+// at from, if known. Buckets without a snapshot carry the previous balance
+// forward, and buckets before the first known balance are omitted. snapshots
+// must be ordered by CreatedAt.
+func BucketBalanceHistory(
+	opening *model.BalanceSnapshot,
+	snapshots []model.BalanceSnapshot,
+	interval Interval,
+	from, to time.Time,
+	loc *time.Location,
+) ([]model.BalanceHistoryPoint, error) {
+	points := []model.BalanceHistoryPoint{}
+
+	current := opening
+	buckets := 0
+	for start := interval.truncate(from.In(loc)); start.Before(to); start = interval.next(start) {
+		if buckets++; buckets > MaxHistoryBuckets {
+			return nil, fmt.Errorf("range exceeds %d buckets", MaxHistoryBuckets)
+		}
+
+		end := interval.next(start)
+		for len(snapshots) > 0 && snapshots[0].CreatedAt.Before(end) {
+			current = &snapshots[0]
+			snapshots = snapshots[1:]
+		}
+
+		if current == nil {
+			continue
+		}
+
+		points = append(points, model.BalanceHistoryPoint{
+			Start:            start,
+			Balance:          current.Balance,
+			ValueInBaseUnits: current.ValueInBaseUnits,
+			CurrencyCode:     current.CurrencyCode,
+		})
+	}
+
+	return points, nil
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+const defaultContentType = "application/json"
+
+// EventData is what deliveries are built from, and what payload templates
+// are executed with.
+type EventData struct {
+	EventId        string
+	EventType      string
+	EventCreatedAt time.Time
+	Account        model.AccountResource
+	Transaction    model.TransactionResource
+
+	// Category and ParentCategory are nil when the transaction is
+	// uncategorised or the lookup failed.
+	Category       *model.CategoryResource
+	ParentCategory *model.CategoryResource
+}
+
+var templateFuncs = template.FuncMap{
+	"currency": templateCurrency,
+	"date":     templateDate,
+	"json":     templateJSON,
+}
+
+// templates caches parsed templates by body.
+var templates sync.Map
+
+func parseTemplate(body string) (*template.Template, error) {
+	if t, ok := templates.Load(body); ok {
+		return t.(*template.Template), nil
+	}
+
+	t, err := template.New("payload").Funcs(templateFuncs).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	templates.Store(body, t)
+	return t, nil
+}
+
+func ValidateTemplate(t model.PayloadTemplate) error {
+	if t.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(t.ContentType); err != nil {
+			return fmt.Errorf("invalid content type: %w", err)
+		}
+	}
+
+	_, err := parseTemplate(t.Body)
+	return err
+}
+
+// RenderTemplate returns the body and content type of a templated delivery.
+func RenderTemplate(t model.PayloadTemplate, data EventData) ([]byte, string, error) {
+	tmpl, err := parseTemplate(t.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, "", err
+	}
+
+	contentType := t.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+
+	return buf.Bytes(), contentType, nil
+}
+
+// templateCurrency formats a MoneyObject with its currency symbol, such as
+// -$10.56.
+func templateCurrency(v any) (string, error) {
+	var m model.MoneyObject
+	switch v := v.(type) {
+	case model.MoneyObject:
+		m = v
+	case *model.MoneyObject:
+		if v == nil {
+			return "", nil
+		}
+		m = *v
+	default:
+		return "", fmt.Errorf("currency: unsupported type %T", v)
+	}
+
+	if value, ok := strings.CutPrefix(m.Value, "-"); ok {
+		return "-" + formatCurrency(value, m.CurrencyCode), nil
+	}
+
+	return formatCurrency(m.Value, m.CurrencyCode), nil
+}
+
+// templateDate formats a time with a Go layout. It takes the layout first so
+// that it can be used in a pipeline.
+func templateDate(layout string, v any) (string, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v.Format(layout), nil
+	case *time.Time:
+		if v == nil {
+			return "", nil
+		}
+		return v.Format(layout), nil
+	default:
+		return "", fmt.Errorf("date: unsupported type %T", v)
+	}
+}
+
+// templateJSON encodes a value as JSON, so strings are quoted and escaped.
+func templateJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
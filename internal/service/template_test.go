@@ -0,0 +1,146 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/baely/balance/pkg/model"
+	"github.com/baely/balance/pkg/up/uptest"
+)
+
+func templateEvent(t *testing.T) EventData {
+	t.Helper()
+
+	fixtures := uptest.DefaultFixtures()
+	event := EventData{
+		EventId:     "evt_1",
+		EventType:   "TRANSACTION_CREATED",
+		Account:     fixtures.Accounts[0],
+		Transaction: fixtures.Transactions[0],
+	}
+	for i, category := range fixtures.Categories {
+		switch category.Id {
+		case "restaurants-and-cafes":
+			event.Category = &fixtures.Categories[i]
+		case "good-life":
+			event.ParentCategory = &fixtures.Categories[i]
+		}
+	}
+
+	return event
+}
+
+func TestRenderTemplate(t *testing.T) {
+	fixtures := uptest.DefaultFixtures()
+	metro := fixtures.Transactions[3]
+
+	tests := []struct {
+		name            string
+		template        model.PayloadTemplate
+		uncategorised   bool
+		transaction     *model.TransactionResource
+		want            string
+		wantContentType string
+	}{
+		{
+			name:            "readme example",
+			template:        model.PayloadTemplate{Body: `{"text": {{printf "%s at %s" (currency .Transaction.Attributes.Amount) .Transaction.Attributes.Description | json}}}`},
+			want:            `{"text": "-$10.56 at Seven Seas Cafe"}`,
+			wantContentType: "application/json",
+		},
+		{
+			name:            "content type",
+			template:        model.PayloadTemplate{Body: `{{.EventType}} {{.Account.Attributes.DisplayName}}`, ContentType: "text/plain"},
+			want:            "TRANSACTION_CREATED Spending",
+			wantContentType: "text/plain",
+		},
+		{
+			name:            "date",
+			template:        model.PayloadTemplate{Body: `{{date "2 Jan 15:04" .Transaction.Attributes.CreatedAt}}`},
+			want:            "20 May 08:15",
+			wantContentType: "application/json",
+		},
+		{
+			name:            "categories",
+			template:        model.PayloadTemplate{Body: `{{with .Category}}{{.Attributes.Name}}{{end}} in {{with .ParentCategory}}{{.Attributes.Name}}{{end}}`},
+			want:            "Restaurants & Cafes in Good Life",
+			wantContentType: "application/json",
+		},
+		{
+			name:            "uncategorised",
+			template:        model.PayloadTemplate{Body: `[{{with .Category}}{{.Attributes.Name}}{{end}}]`},
+			uncategorised:   true,
+			want:            "[]",
+			wantContentType: "application/json",
+		},
+		{
+			name:            "foreign amount",
+			template:        model.PayloadTemplate{Body: `{{currency .Transaction.Attributes.ForeignAmount}} ({{currency .Transaction.Attributes.Amount}})`},
+			transaction:     &metro,
+			want:            "-¥260 (-$2.59)",
+			wantContentType: "application/json",
+		},
+		{
+			name:            "missing foreign amount",
+			template:        model.PayloadTemplate{Body: `[{{currency .Transaction.Attributes.ForeignAmount}}]`},
+			want:            "[]",
+			wantContentType: "application/json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := templateEvent(t)
+			if tt.uncategorised {
+				event.Category, event.ParentCategory = nil, nil
+			}
+			if tt.transaction != nil {
+				event.Transaction = *tt.transaction
+			}
+
+			body, contentType, err := RenderTemplate(tt.template, event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.want {
+				t.Errorf("body = %s, want %s", body, tt.want)
+			}
+			if contentType != tt.wantContentType {
+				t.Errorf("content type = %s, want %s", contentType, tt.wantContentType)
+			}
+		})
+	}
+}
+
+func TestRenderTemplateError(t *testing.T) {
+	// Fails when executed rather than when parsed
+	template := model.PayloadTemplate{Body: `{{currency .Transaction.Attributes.Description}}`}
+	if err := ValidateTemplate(template); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := RenderTemplate(template, templateEvent(t)); err == nil {
+		t.Error("RenderTemplate() = nil, want an error")
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template model.PayloadTemplate
+		wantErr  bool
+	}{
+		{name: "plain", template: model.PayloadTemplate{Body: `{{.EventId}}`}},
+		{name: "content type", template: model.PayloadTemplate{Body: `{{.EventId}}`, ContentType: "text/plain; charset=utf-8"}},
+		{name: "unclosed action", template: model.PayloadTemplate{Body: `{{.EventId`}, wantErr: true},
+		{name: "unknown function", template: model.PayloadTemplate{Body: `{{upper .EventId}}`}, wantErr: true},
+		{name: "invalid content type", template: model.PayloadTemplate{Body: `{{.EventId}}`, ContentType: "text/"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateTemplate(tt.template); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTemplate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
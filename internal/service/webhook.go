@@ -1,11 +1,8 @@
 package service
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"net/http"
-	"net/url"
 	"strings"
 
 	"github.com/baely/balance/pkg/model"
@@ -28,12 +25,9 @@ func formatCurrency(value string, iso string) string {
 	return s
 }
 
-func SendWebhookEvent(uri string, account model.AccountResource, transaction model.TransactionResource) error {
-	_, err := url.Parse(uri)
-	if err != nil {
-		return err
-	}
-
+// WebhookEventPayload renders the summary event sent to webhook subscribers.
+// Only debits are summarised, so ok is false for any other transaction.
+func WebhookEventPayload(account model.AccountResource, transaction model.TransactionResource) (payload []byte, ok bool, err error) {
 	foreign := false
 	amt := transaction.Attributes.Amount.Value
 
@@ -45,7 +39,7 @@ func SendWebhookEvent(uri string, account model.AccountResource, transaction mod
 	// Validate amount is negative
 	if len(amt) == 0 || amt[0] != '-' {
 		fmt.Println("non neg amount.", transaction.Attributes.Description, amt)
-		return nil
+		return nil, false, nil
 	}
 
 	amt = amt[1:]
@@ -63,49 +57,18 @@ func SendWebhookEvent(uri string, account model.AccountResource, transaction mod
 
 	eventMsg, err := json.Marshal(event)
 	if err != nil {
-		return err
+		return nil, false, err
 	}
 
-	msg := bytes.NewReader(eventMsg)
-
-	resp, err := http.Post(uri, "application/json", msg)
-	if err != nil {
-		return err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("invalid request")
-	}
-
-	return nil
+	return eventMsg, true, nil
 }
 
-func SendRawWebhookEvent(uri string, account model.AccountResource, transaction model.TransactionResource) error {
-	_, err := url.Parse(uri)
-	if err != nil {
-		return err
-	}
-
+// RawWebhookEventPayload renders the event sent to raw webhook subscribers.
+func RawWebhookEventPayload(account model.AccountResource, transaction model.TransactionResource) ([]byte, error) {
 	event := model.RawWebhookEvent{
 		Account:     account,
 		Transaction: transaction,
 	}
 
-	eventMsg, err := json.Marshal(event)
-	if err != nil {
-		return err
-	}
-
-	msg := bytes.NewReader(eventMsg)
-
-	resp, err := http.Post(uri, "application/json", msg)
-	if err != nil {
-		return err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to post")
-	}
-
-	return nil
+	return json.Marshal(event)
 }
@@ -1,11 +1,76 @@
 package main
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/baely/balance/internal/database"
+	"github.com/baely/balance/internal/integrations"
+)
 
 func main() {
-	s := newServer()
+	store, err := database.GetStore()
+	if err != nil {
+		panic(err)
+	}
+	defer store.Close()
+
+	bus, err := integrations.GetBus()
+	if err != nil {
+		panic(err)
+	}
+	defer bus.Close()
+
+	s := newServer(store, bus)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Failed subscriber deliveries are retried in the background
+	go s.dispatcher.Run(ctx)
+
+	subscription := os.Getenv("WORKER_SUBSCRIPTION")
+	if subscription == "" {
+		subscription = "process"
+	}
+
+	concurrency, _ := strconv.Atoi(os.Getenv("WORKER_CONCURRENCY"))
+	if concurrency == 0 {
+		concurrency = 4
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		if err := s.runWorker(ctx, subscription, concurrency); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	// Without a cloud bus, webhook events are processed in-process. The
+	// subscription is made before serving, since the memory bus drops events
+	// published to a topic nobody has subscribed to yet
+	if _, ok := bus.(*integrations.MemoryBus); ok {
+		fmt.Println("Processing webhook events in-process")
+		msgs, err := bus.Subscribe(ctx, integrations.WebhookEventsTopic, subscription)
+		if err != nil {
+			panic(err)
+		}
+		go s.consume(ctx, msgs, subscription, concurrency)
+	}
+
+	go func() {
+		<-ctx.Done()
+		s.Shutdown(context.Background())
+	}()
+
 	fmt.Println("Starting server")
-	if err := s.ListenAndServe(); err != nil {
+	if err := s.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		panic(err)
 	}
 }
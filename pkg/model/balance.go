@@ -0,0 +1,64 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+type AccountBalance struct {
+	AccountId     string    `json:"account_id"`
+	DisplayName   string    `json:"display_name"`
+	AccountType   string    `json:"account_type"`
+	OwnershipType string    `json:"ownership_type"`
+	Balance       string    `json:"balance"`
+	CurrencyCode  string    `json:"currency_code"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	// AsOf is when the balance was fetched from Up. Up serves the live
+	// balance whichever event prompted the fetch, so the latest fetch wins,
+	// not the latest event. Stored balances only ever move forward in AsOf.
+	AsOf time.Time `json:"as_of"`
+}
+
+func NewAccountBalance(account AccountResource, fetchedAt time.Time) AccountBalance {
+	return AccountBalance{
+		AccountId:     account.Id,
+		DisplayName:   account.Attributes.DisplayName,
+		AccountType:   fmt.Sprint(account.Attributes.AccountType),
+		OwnershipType: fmt.Sprint(account.Attributes.OwnershipType),
+		Balance:       account.Attributes.Balance.Value,
+		CurrencyCode:  account.Attributes.Balance.CurrencyCode,
+		UpdatedAt:     fetchedAt,
+		AsOf:          fetchedAt,
+	}
+}
+
+// BalanceSnapshot is an account balance recorded after a transaction.
+type BalanceSnapshot struct {
+	AccountId        string    `json:"account_id"`
+	TransactionId    string    `json:"transaction_id"`
+	Balance          string    `json:"balance"`
+	ValueInBaseUnits int       `json:"value_in_base_units"`
+	CurrencyCode     string    `json:"currency_code"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+func NewBalanceSnapshot(account AccountResource, transaction TransactionResource) BalanceSnapshot {
+	return BalanceSnapshot{
+		AccountId:        account.Id,
+		TransactionId:    transaction.Id,
+		Balance:          account.Attributes.Balance.Value,
+		ValueInBaseUnits: account.Attributes.Balance.ValueInBaseUnits,
+		CurrencyCode:     account.Attributes.Balance.CurrencyCode,
+		CreatedAt:        transaction.Attributes.CreatedAt,
+	}
+}
+
+// BalanceHistoryPoint is the closing balance of an account for the bucket
+// starting at Start.
+type BalanceHistoryPoint struct {
+	Start            time.Time `json:"start"`
+	Balance          string    `json:"balance"`
+	ValueInBaseUnits int       `json:"value_in_base_units"`
+	CurrencyCode     string    `json:"currency_code"`
+}
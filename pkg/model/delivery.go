@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryDead      DeliveryStatus = "dead"
+)
+
+// Delivery is an outbound webhook request to a subscriber and the state of
+// its retries.
+type Delivery struct {
+	Id             string            `json:"id"`
+	EventId        string            `json:"event_id"`
+	SubscriptionId string            `json:"subscription_id"`
+	Uri            string            `json:"uri"`
+	ContentType    string            `json:"content_type"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	Payload        string            `json:"payload"`
+	Status         DeliveryStatus    `json:"status"`
+	Attempts       int               `json:"attempts"`
+	NextAttemptAt  time.Time         `json:"next_attempt_at"`
+	LastError      string            `json:"last_error,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+// DeliveryAttempt records a single request made for a delivery.
+type DeliveryAttempt struct {
+	Id             string `json:"id"`
+	DeliveryId     string `json:"delivery_id"`
+	SubscriptionId string `json:"subscription_id"`
+	EventId        string `json:"event_id"`
+	Attempt        int    `json:"attempt"`
+
+	// BodyHash is the hex encoded SHA-256 of the request body.
+	BodyHash string `json:"body_hash"`
+
+	// StatusCode is zero if no response was received.
+	StatusCode int       `json:"status_code,omitempty"`
+	LatencyMs  int64     `json:"latency_ms"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,115 @@
+package model
+
+import "time"
+
+type SubscriptionType string
+
+const (
+	// SubscriptionSummary receives a WebhookEvent for new debits on
+	// transactional accounts.
+	SubscriptionSummary SubscriptionType = "summary"
+
+	// SubscriptionRaw receives a RawWebhookEvent for every transaction event.
+	SubscriptionRaw SubscriptionType = "raw"
+)
+
+func (t SubscriptionType) Valid() bool {
+	return t == SubscriptionSummary || t == SubscriptionRaw
+}
+
+// SubscriptionFormat is how deliveries are wrapped. The zero value sends the
+// payload as is.
+type SubscriptionFormat string
+
+const (
+	// FormatCloudEvents sends a CloudEvent in structured mode, with the
+	// event attributes and data in the body.
+	FormatCloudEvents SubscriptionFormat = "cloudevents"
+
+	// FormatCloudEventsBinary sends a CloudEvent in binary mode, with the
+	// event attributes in ce- headers and the data as the body.
+	FormatCloudEventsBinary SubscriptionFormat = "cloudevents-binary"
+)
+
+func (f SubscriptionFormat) Valid() bool {
+	return f == "" || f == FormatCloudEvents || f == FormatCloudEventsBinary
+}
+
+type Subscription struct {
+	Id          string           `json:"id"`
+	Type        SubscriptionType `json:"type"`
+	Uri         string           `json:"uri"`
+	Description string           `json:"description"`
+	Enabled     bool             `json:"enabled"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+
+	// Filter limits the events delivered to the subscriber. Subscriptions
+	// without a filter get the default for their type.
+	Filter *SubscriptionFilter `json:"filter,omitempty"`
+
+	// Template replaces the payload of the subscription's type.
+	Template *PayloadTemplate `json:"template,omitempty"`
+
+	Format SubscriptionFormat `json:"format,omitempty"`
+
+	Health SubscriptionHealth `json:"health"`
+
+	// Secret signs every delivery to the subscriber. It is only returned when
+	// the subscription is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+type Direction string
+
+const (
+	Debit  Direction = "debit"
+	Credit Direction = "credit"
+)
+
+// SubscriptionFilter matches transaction events. Every field that is set must
+// match, and a list matches if any of its values do.
+type SubscriptionFilter struct {
+	EventTypes   []string `json:"event_types,omitempty"`
+	AccountIds   []string `json:"account_ids,omitempty"`
+	AccountTypes []string `json:"account_types,omitempty"`
+
+	// MinAmount and MaxAmount bound the size of the transaction in base
+	// units, whichever its direction.
+	MinAmount *int      `json:"min_amount,omitempty"`
+	MaxAmount *int      `json:"max_amount,omitempty"`
+	Direction Direction `json:"direction,omitempty"`
+
+	// Categories match either the category or the parent category.
+	Categories  []string `json:"categories,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	ForeignOnly bool     `json:"foreign_only,omitempty"`
+
+	// Expression is an expr-lang expression over account and transaction,
+	// using the field names of the Up API.
+	Expression string `json:"expression,omitempty"`
+}
+
+// PayloadTemplate renders a delivery with text/template.
+type PayloadTemplate struct {
+	Body string `json:"body"`
+
+	// ContentType defaults to application/json.
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// SubscriptionHealth tracks failing deliveries to a subscriber. After enough
+// consecutive failures the circuit opens and deliveries are held back, with
+// one let through at NextProbeAt to check whether the subscriber recovered.
+type SubscriptionHealth struct {
+	ConsecutiveFailures int `json:"consecutive_failures"`
+
+	// FailingSince is when the current run of failures started.
+	FailingSince *time.Time `json:"failing_since,omitempty"`
+
+	CircuitOpen bool       `json:"circuit_open"`
+	NextProbeAt *time.Time `json:"next_probe_at,omitempty"`
+
+	// DisabledAt is when the subscription was disabled for failing too long.
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+}
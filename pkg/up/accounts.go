@@ -0,0 +1,31 @@
+package up
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+// ListAccounts returns the first page of accounts.
+func (c *Client) ListAccounts(ctx context.Context, params *model.GetAccountsParams) (model.ListAccountsResponse, error) {
+	var resp model.ListAccountsResponse
+	err := c.do(ctx, http.MethodGet, c.endpoint("accounts", encodeParams(params)), nil, &resp)
+	return resp, err
+}
+
+// Accounts iterates over every account. params.PageSize sets how many are
+// fetched per request.
+func (c *Client) Accounts(ctx context.Context, params *model.GetAccountsParams) *Iterator[model.AccountResource] {
+	return newIterator[model.AccountResource](ctx, c, c.endpoint("accounts", encodeParams(params)))
+}
+
+func (c *Client) GetAccount(ctx context.Context, accountId string) (model.AccountResource, error) {
+	var resp model.GetAccountResponse
+	if err := c.do(ctx, http.MethodGet, c.endpoint("accounts/"+url.PathEscape(accountId), nil), nil, &resp); err != nil {
+		return model.AccountResource{}, err
+	}
+
+	return resp.Data, nil
+}
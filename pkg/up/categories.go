@@ -0,0 +1,36 @@
+package up
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+// ListCategories returns every category, or the children of
+// params.FilterParent. Categories are not paginated.
+func (c *Client) ListCategories(ctx context.Context, params *model.GetCategoriesParams) ([]model.CategoryResource, error) {
+	var resp model.ListCategoriesResponse
+	if err := c.do(ctx, http.MethodGet, c.endpoint("categories", encodeParams(params)), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Data, nil
+}
+
+func (c *Client) GetCategory(ctx context.Context, categoryId string) (model.CategoryResource, error) {
+	var resp model.GetCategoryResponse
+	if err := c.do(ctx, http.MethodGet, c.endpoint("categories/"+url.PathEscape(categoryId), nil), nil, &resp); err != nil {
+		return model.CategoryResource{}, err
+	}
+
+	return resp.Data, nil
+}
+
+// ListTags returns the first page of tags.
+func (c *Client) ListTags(ctx context.Context, params *model.GetTagsParams) (model.ListTagsResponse, error) {
+	var resp model.ListTagsResponse
+	err := c.do(ctx, http.MethodGet, c.endpoint("tags", encodeParams(params)), nil, &resp)
+	return resp, err
+}
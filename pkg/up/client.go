@@ -0,0 +1,194 @@
+// Package up is a client for the Up Banking API.
+package up
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+const DefaultBaseURL = "https://api.up.com.au/api/v1/"
+
+type Client struct {
+	accessToken string
+	baseURL     string
+	httpClient  *http.Client
+	retry       RetryPolicy
+}
+
+type Option func(*Client)
+
+// WithBaseURL points the client at another Up API, such as a fake one.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		if !strings.HasSuffix(baseURL, "/") {
+			baseURL += "/"
+		}
+		c.baseURL = baseURL
+	}
+}
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetryPolicy changes how rate limited and failed requests are retried.
+// A MaxAttempts of 1 turns retries off.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+func NewClient(accessToken string, opts ...Option) *Client {
+	c := &Client{
+		accessToken: accessToken,
+		baseURL:     DefaultBaseURL,
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		retry:       DefaultRetryPolicy,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Ping checks that the access token is valid.
+func (c *Client) Ping(ctx context.Context) (model.PingResponse, error) {
+	var resp model.PingResponse
+	err := c.do(ctx, http.MethodGet, c.endpoint("util/ping", nil), nil, &resp)
+	return resp, err
+}
+
+// endpoint returns the URL of path, relative to the base URL.
+func (c *Client) endpoint(path string, query url.Values) string {
+	uri := c.baseURL + path
+	if len(query) > 0 {
+		uri += "?" + query.Encode()
+	}
+
+	return uri
+}
+
+// do makes a request to uri and decodes the response into ret if it is not
+// nil. Rate limited requests and server errors are retried following the
+// client's retry policy, waiting as long as Up asks to with Retry-After.
+func (c *Client) do(ctx context.Context, method, uri string, body, ret any) error {
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, method, uri, b)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			defer resp.Body.Close()
+
+			if ret == nil || resp.StatusCode == http.StatusNoContent {
+				return nil
+			}
+			return json.NewDecoder(resp.Body).Decode(ret)
+		}
+
+		upErr := decodeError(resp)
+		if attempt >= c.retry.MaxAttempts || !retryable(method, resp.StatusCode) {
+			return upErr
+		}
+
+		delay, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			delay = c.retry.Backoff(attempt)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, uri string, body []byte) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, uri, r)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.accessToken))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return c.httpClient.Do(req)
+}
+
+// decodeError reads the error objects from a failed response and closes its
+// body.
+func decodeError(resp *http.Response) *Error {
+	defer resp.Body.Close()
+
+	upErr := &Error{StatusCode: resp.StatusCode}
+
+	var errResp model.ErrorResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&errResp); err == nil {
+		upErr.Errors = errResp.Errors
+	}
+
+	return upErr
+}
+
+// encodeParams turns one of the generated Get*Params structs into query
+// parameters using their form tags. Unset fields are left out.
+func encodeParams(params any) url.Values {
+	query := url.Values{}
+
+	v := reflect.ValueOf(params)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return query
+		}
+		v = v.Elem()
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("form"), ",")
+		field := v.Field(i)
+		if name == "" || field.Kind() != reflect.Pointer || field.IsNil() {
+			continue
+		}
+
+		switch value := field.Elem().Interface().(type) {
+		case time.Time:
+			query.Set(name, value.Format(time.RFC3339))
+		default:
+			query.Set(name, fmt.Sprint(value))
+		}
+	}
+
+	return query
+}
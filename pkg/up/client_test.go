@@ -0,0 +1,97 @@
+package up_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/baely/balance/pkg/up"
+	"github.com/baely/balance/pkg/up/uptest"
+)
+
+const spendingAccountId = "9b3a9e7c-4f6b-4c3e-9a55-1d2f0c8e7a11"
+
+// noRetry keeps failing requests from being retried, so tests see the error.
+var noRetry = up.WithRetryPolicy(up.RetryPolicy{MaxAttempts: 1})
+
+func TestClientNotFound(t *testing.T) {
+	fake := uptest.NewServer(uptest.DefaultFixtures())
+	defer fake.Close()
+
+	_, err := fake.Client().GetTransaction(context.Background(), "missing")
+	if !up.IsNotFound(err) {
+		t.Errorf("GetTransaction() = %v, want not found", err)
+	}
+}
+
+func TestClientEscapesIds(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client := up.NewClient("up:yeah:test", up.WithBaseURL(server.URL), noRetry)
+	ctx := context.Background()
+
+	// An ID cannot step out of its resource or add a query
+	client.GetAccount(ctx, "../transactions")
+	client.GetTransaction(ctx, "tx?filter[status]=HELD")
+	client.GetCategory(ctx, "home/")
+	client.DeleteWebhook(ctx, "a b")
+
+	want := []string{
+		"/accounts/..%2Ftransactions",
+		"/transactions/tx%3Ffilter%5Bstatus%5D=HELD",
+		"/categories/home%2F",
+		"/webhooks/a%20b",
+	}
+	if len(paths) != len(want) {
+		t.Fatalf("got %d requests, want %d", len(paths), len(want))
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Errorf("path = %s, want %s", paths[i], want[i])
+		}
+	}
+}
+
+func TestClientRetriesRateLimit(t *testing.T) {
+	fake := uptest.NewServer(uptest.DefaultFixtures())
+	defer fake.Close()
+
+	fake.Inject(uptest.Fault{Path: "accounts/*", Status: http.StatusTooManyRequests, Times: 2})
+
+	client := fake.Client(up.WithRetryPolicy(up.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}))
+	account, err := client.GetAccount(context.Background(), spendingAccountId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Id != spendingAccountId {
+		t.Errorf("account = %s, want %s", account.Id, spendingAccountId)
+	}
+}
+
+func TestClientGivesUp(t *testing.T) {
+	fake := uptest.NewServer(uptest.DefaultFixtures())
+	defer fake.Close()
+
+	fake.Inject(uptest.Fault{Path: "accounts/*", Status: http.StatusServiceUnavailable, Times: 3})
+
+	client := fake.Client(up.WithRetryPolicy(up.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}))
+	_, err := client.GetAccount(context.Background(), spendingAccountId)
+
+	var upErr *up.Error
+	if !errors.As(err, &upErr) || upErr.StatusCode != http.StatusServiceUnavailable || !upErr.Temporary() {
+		t.Errorf("GetAccount() = %v, want a temporary 503 *up.Error", err)
+	}
+
+	// The third request gets the last fault, and the fourth gets through
+	if _, err := client.GetAccount(context.Background(), spendingAccountId); err != nil {
+		t.Errorf("GetAccount() = %v after the faults, want nil", err)
+	}
+}
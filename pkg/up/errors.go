@@ -0,0 +1,50 @@
+package up
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+// Error is returned when Up responds with an error status. Errors holds the
+// error objects from the response body, if it had any.
+type Error struct {
+	StatusCode int
+	Errors     []model.ErrorObject
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("up: request failed with status %d", e.StatusCode)
+
+	var details []string
+	for _, obj := range e.Errors {
+		detail := obj.Title
+		if obj.Detail != "" {
+			detail += ": " + obj.Detail
+		}
+		details = append(details, detail)
+	}
+	if len(details) > 0 {
+		msg += ": " + strings.Join(details, "; ")
+	}
+
+	return msg
+}
+
+// Temporary reports whether the request may succeed if it is made again
+// later. Other errors, such as a bad token or a deleted transaction, will keep
+// failing.
+func (e *Error) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode == http.StatusRequestTimeout ||
+		e.StatusCode >= 500
+}
+
+// IsNotFound reports whether err is an Up 404 response.
+func IsNotFound(err error) bool {
+	var upErr *Error
+	return errors.As(err, &upErr) && upErr.StatusCode == http.StatusNotFound
+}
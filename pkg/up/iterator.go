@@ -0,0 +1,72 @@
+package up
+
+import (
+	"context"
+	"net/http"
+)
+
+// Iterator walks every page of an Up list endpoint, following links.next
+// until there are no more pages:
+//
+//	it := client.Transactions(ctx, params)
+//	for it.Next() {
+//		transaction := it.Value()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type Iterator[T any] struct {
+	ctx    context.Context
+	client *Client
+	next   string
+	page   []T
+	value  T
+	err    error
+}
+
+// page is the shape shared by every paginated list response.
+type page[T any] struct {
+	Data  []T `json:"data"`
+	Links struct {
+		Next *string `json:"next"`
+	} `json:"links"`
+}
+
+func newIterator[T any](ctx context.Context, c *Client, uri string) *Iterator[T] {
+	return &Iterator[T]{ctx: ctx, client: c, next: uri}
+}
+
+// Next advances to the next resource, fetching the next page when the current
+// one runs out. It returns false when there are no more resources or a
+// request fails.
+func (it *Iterator[T]) Next() bool {
+	for len(it.page) == 0 {
+		if it.err != nil || it.next == "" {
+			return false
+		}
+
+		var resp page[T]
+		if err := it.client.do(it.ctx, http.MethodGet, it.next, nil, &resp); err != nil {
+			it.err = err
+			return false
+		}
+
+		it.page = resp.Data
+		it.next = ""
+		if resp.Links.Next != nil {
+			it.next = *resp.Links.Next
+		}
+	}
+
+	it.value, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Value returns the current resource.
+func (it *Iterator[T]) Value() T {
+	return it.value
+}
+
+// Err returns the error that stopped the iterator, if any.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
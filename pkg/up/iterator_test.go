@@ -0,0 +1,93 @@
+package up_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/baely/balance/pkg/model"
+	"github.com/baely/balance/pkg/up"
+	"github.com/baely/balance/pkg/up/uptest"
+)
+
+func pageSize(n int) *int {
+	return &n
+}
+
+func TestTransactionsIterator(t *testing.T) {
+	fake := uptest.NewServer(uptest.DefaultFixtures())
+	defer fake.Close()
+
+	// A page size of 2 spreads the 5 fixtures over 3 pages
+	it := fake.Client().Transactions(context.Background(), &model.GetTransactionsParams{PageSize: pageSize(2)})
+
+	var ids []string
+	for it.Next() {
+		ids = append(ids, it.Value().Id)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := uptest.DefaultFixtures().Transactions
+	if len(ids) != len(want) {
+		t.Fatalf("got %d transactions, want %d", len(ids), len(want))
+	}
+	for i, transaction := range want {
+		if ids[i] != transaction.Id {
+			t.Errorf("transaction %d = %s, want %s", i, ids[i], transaction.Id)
+		}
+	}
+}
+
+func TestAccountTransactionsIterator(t *testing.T) {
+	fake := uptest.NewServer(uptest.DefaultFixtures())
+	defer fake.Close()
+
+	it := fake.Client().AccountTransactions(context.Background(), spendingAccountId, &model.GetAccountsAccountIdTransactionsParams{PageSize: pageSize(1)})
+
+	n := 0
+	for it.Next() {
+		n++
+		if account := it.Value().Relationships.Account.Data.Id; account != spendingAccountId {
+			t.Errorf("transaction of account %s, want %s", account, spendingAccountId)
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("got %d transactions, want 3", n)
+	}
+}
+
+func TestIteratorStopsOnError(t *testing.T) {
+	fake := uptest.NewServer(uptest.DefaultFixtures())
+	defer fake.Close()
+
+	it := fake.Client(noRetry).Transactions(context.Background(), &model.GetTransactionsParams{PageSize: pageSize(2)})
+
+	// The first page is fetched before the fault is added, so it fails on
+	// the second page
+	if !it.Next() {
+		t.Fatalf("Next() = false, err %v", it.Err())
+	}
+	fake.Inject(uptest.Fault{Path: "transactions", Status: http.StatusInternalServerError})
+
+	n := 1
+	for it.Next() {
+		n++
+	}
+	if n != 2 {
+		t.Errorf("got %d transactions before the error, want 2", n)
+	}
+
+	var upErr *up.Error
+	if err := it.Err(); err == nil || !errors.As(err, &upErr) || upErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Err() = %v, want a 500 *up.Error", err)
+	}
+	if it.Next() {
+		t.Error("Next() = true after an error")
+	}
+}
@@ -0,0 +1,78 @@
+package up
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Second},
+		{attempts: 2, want: 2 * time.Second},
+		{attempts: 4, want: 8 * time.Second},
+		{attempts: 6, want: 30 * time.Second},
+		{attempts: 100, want: 30 * time.Second},
+		{attempts: 1 << 30, want: 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			got := p.Backoff(tt.attempts)
+			if got < tt.want/2 || got > tt.want {
+				t.Fatalf("Backoff(%d) = %v, want between %v and %v", tt.attempts, got, tt.want/2, tt.want)
+			}
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		method     string
+		statusCode int
+		want       bool
+	}{
+		{http.MethodGet, http.StatusTooManyRequests, true},
+		{http.MethodPost, http.StatusTooManyRequests, true},
+		{http.MethodGet, http.StatusBadGateway, true},
+		{http.MethodDelete, http.StatusInternalServerError, true},
+		{http.MethodPost, http.StatusInternalServerError, false},
+		{http.MethodGet, http.StatusNotFound, false},
+		{http.MethodGet, http.StatusUnauthorized, false},
+	}
+
+	for _, tt := range tests {
+		if got := retryable(tt.method, tt.statusCode); got != tt.want {
+			t.Errorf("retryable(%s, %d) = %v, want %v", tt.method, tt.statusCode, got, tt.want)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{header: "", ok: false},
+		{header: "3", want: 3 * time.Second, ok: true},
+		{header: "-1", ok: false},
+		{header: "soon", ok: false},
+		{header: now.Add(10 * time.Second).Format(http.TimeFormat), want: 10 * time.Second, ok: true},
+		{header: now.Add(-time.Minute).Format(http.TimeFormat), want: 0, ok: true},
+	}
+
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.header, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package up
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+// ListTransactions returns the first page of transactions across every
+// account, newest first.
+func (c *Client) ListTransactions(ctx context.Context, params *model.GetTransactionsParams) (model.ListTransactionsResponse, error) {
+	var resp model.ListTransactionsResponse
+	err := c.do(ctx, http.MethodGet, c.endpoint("transactions", encodeParams(params)), nil, &resp)
+	return resp, err
+}
+
+// ListAccountTransactions returns the first page of transactions of an
+// account, newest first.
+func (c *Client) ListAccountTransactions(ctx context.Context, accountId string, params *model.GetAccountsAccountIdTransactionsParams) (model.ListTransactionsResponse, error) {
+	var resp model.ListTransactionsResponse
+	err := c.do(ctx, http.MethodGet, c.endpoint("accounts/"+url.PathEscape(accountId)+"/transactions", encodeParams(params)), nil, &resp)
+	return resp, err
+}
+
+// Transactions iterates over every transaction matching the filters in
+// params, newest first.
+func (c *Client) Transactions(ctx context.Context, params *model.GetTransactionsParams) *Iterator[model.TransactionResource] {
+	return newIterator[model.TransactionResource](ctx, c, c.endpoint("transactions", encodeParams(params)))
+}
+
+// AccountTransactions iterates over every transaction of an account matching
+// the filters in params, newest first.
+func (c *Client) AccountTransactions(ctx context.Context, accountId string, params *model.GetAccountsAccountIdTransactionsParams) *Iterator[model.TransactionResource] {
+	return newIterator[model.TransactionResource](ctx, c, c.endpoint("accounts/"+url.PathEscape(accountId)+"/transactions", encodeParams(params)))
+}
+
+func (c *Client) GetTransaction(ctx context.Context, transactionId string) (model.TransactionResource, error) {
+	var resp model.GetTransactionResponse
+	if err := c.do(ctx, http.MethodGet, c.endpoint("transactions/"+url.PathEscape(transactionId), nil), nil, &resp); err != nil {
+		return model.TransactionResource{}, err
+	}
+
+	return resp.Data, nil
+}
+
+// UpdateTransactionCategory sets the category of a transaction. An empty
+// categoryId removes its category.
+func (c *Client) UpdateTransactionCategory(ctx context.Context, transactionId, categoryId string) error {
+	var req model.UpdateTransactionCategoryRequest
+	if categoryId != "" {
+		req.Data = &model.CategoryInputResourceIdentifier{
+			Id:   categoryId,
+			Type: "categories",
+		}
+	}
+
+	return c.do(ctx, http.MethodPatch, c.endpoint("transactions/"+url.PathEscape(transactionId)+"/relationships/category", nil), req, nil)
+}
+
+func (c *Client) AddTransactionTags(ctx context.Context, transactionId string, tags ...string) error {
+	return c.do(ctx, http.MethodPost, c.endpoint("transactions/"+url.PathEscape(transactionId)+"/relationships/tags", nil), tagsRequest(tags), nil)
+}
+
+func (c *Client) RemoveTransactionTags(ctx context.Context, transactionId string, tags ...string) error {
+	return c.do(ctx, http.MethodDelete, c.endpoint("transactions/"+url.PathEscape(transactionId)+"/relationships/tags", nil), tagsRequest(tags), nil)
+}
+
+func tagsRequest(tags []string) model.UpdateTransactionTagsRequest {
+	req := model.UpdateTransactionTagsRequest{
+		Data: make([]model.TagInputResourceIdentifier, 0, len(tags)),
+	}
+	for _, tag := range tags {
+		req.Data = append(req.Data, model.TagInputResourceIdentifier{
+			Id:   tag,
+			Type: "tags",
+		})
+	}
+
+	return req
+}
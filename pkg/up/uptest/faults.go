@@ -0,0 +1,120 @@
+package uptest
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fault scripts a failure or delay for matching API requests. Faults are
+// checked in the order they were added, and the first match applies.
+type Fault struct {
+	// Method and Path select requests. Path is a path.Match pattern relative
+	// to the API root, such as "accounts/*". Empty values match everything.
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+
+	// Status is the error status returned, or zero to only add latency.
+	// RetryAfter sets the Retry-After header in seconds.
+	Status     int `json:"status,omitempty"`
+	RetryAfter int `json:"retry_after,omitempty"`
+
+	// LatencyMs delays the response.
+	LatencyMs int64 `json:"latency_ms,omitempty"`
+
+	// Times is how many requests the fault applies to, or zero for every
+	// request.
+	Times int `json:"times,omitempty"`
+}
+
+// LoadFaults reads a JSON list of faults.
+func LoadFaults(path string) ([]Fault, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var faults []Fault
+	err = json.Unmarshal(b, &faults)
+	return faults, err
+}
+
+// Inject adds faults after any already scripted.
+func (s *Server) Inject(faults ...Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range faults {
+		s.faults = append(s.faults, &f)
+	}
+}
+
+// ClearFaults removes every scripted fault.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = nil
+}
+
+// takeFault returns the first fault matching a request, using up one of its
+// times.
+func (s *Server) takeFault(method, apiPath string) (Fault, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, f := range s.faults {
+		if f.Method != "" && !strings.EqualFold(f.Method, method) {
+			continue
+		}
+		if f.Path != "" {
+			if ok, _ := path.Match(f.Path, apiPath); !ok {
+				continue
+			}
+		}
+
+		matched := *f
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return matched, true
+	}
+
+	return Fault{}, false
+}
+
+// injectFaults applies scripted faults before requests reach the API.
+func (s *Server) injectFaults(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, ok := s.takeFault(r.Method, strings.TrimPrefix(r.URL.Path, apiRoot))
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if f.LatencyMs > 0 {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(time.Duration(f.LatencyMs) * time.Millisecond):
+			}
+		}
+
+		if f.Status == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if f.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(f.RetryAfter))
+		}
+		writeError(w, f.Status, "Injected fault")
+	})
+}
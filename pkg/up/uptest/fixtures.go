@@ -0,0 +1,44 @@
+package uptest
+
+import (
+	_ "embed"
+	"encoding/json"
+	"os"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+// Fixtures are the resources a fake server starts with. Transactions are
+// listed newest first, as Up returns them.
+type Fixtures struct {
+	Accounts     []model.AccountResource     `json:"accounts"`
+	Categories   []model.CategoryResource    `json:"categories"`
+	Transactions []model.TransactionResource `json:"transactions"`
+}
+
+//go:embed fixtures/fixtures.json
+var defaultFixtures []byte
+
+// DefaultFixtures returns a small set of accounts, categories and
+// transactions, covering a transfer, a held and a foreign transaction.
+func DefaultFixtures() Fixtures {
+	var f Fixtures
+	if err := json.Unmarshal(defaultFixtures, &f); err != nil {
+		panic(err)
+	}
+
+	return f
+}
+
+// LoadFixtures reads fixtures from a JSON file in the same shape as the
+// defaults.
+func LoadFixtures(path string) (Fixtures, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Fixtures{}, err
+	}
+
+	var f Fixtures
+	err = json.Unmarshal(b, &f)
+	return f, err
+}
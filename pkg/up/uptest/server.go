@@ -0,0 +1,490 @@
+// Package uptest is a fake Up API for tests and local development. It serves
+// accounts, transactions, categories, tags and webhooks from fixtures, sends
+// signed webhook events, and can be scripted to fail or slow down.
+package uptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/baely/balance/pkg/model"
+	"github.com/baely/balance/pkg/up"
+)
+
+// apiRoot is where the API is served, matching api.up.com.au.
+const apiRoot = "/api/v1/"
+
+const defaultPageSize = 10
+
+// resourceIdentifier is the shape of every relationship's data.
+type resourceIdentifier = struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// Server is a fake Up API. Use NewServer in tests, or serve it with New on an
+// address of your own.
+type Server struct {
+	// Server is set when started with NewServer.
+	*httptest.Server
+
+	handler http.Handler
+	client  *http.Client
+
+	mu           sync.Mutex
+	accounts     []model.AccountResource
+	categories   []model.CategoryResource
+	transactions []model.TransactionResource
+	webhooks     []*webhook
+	faults       []*Fault
+}
+
+// New returns a fake Up API serving fixtures. It is not started.
+func New(fixtures Fixtures) *Server {
+	s := &Server{
+		client:       &http.Client{Timeout: 10 * time.Second},
+		accounts:     fixtures.Accounts,
+		categories:   fixtures.Categories,
+		transactions: fixtures.Transactions,
+	}
+
+	api := chi.NewRouter()
+	api.Use(s.injectFaults, authenticate)
+	api.Get("/util/ping", s.ping)
+	api.Get("/accounts", s.listAccounts)
+	api.Get("/accounts/{accountId}", s.getAccount)
+	api.Get("/accounts/{accountId}/transactions", s.listAccountTransactions)
+	api.Get("/transactions", s.listTransactions)
+	api.Get("/transactions/{transactionId}", s.getTransaction)
+	api.Patch("/transactions/{transactionId}/relationships/category", s.updateCategory)
+	api.Post("/transactions/{transactionId}/relationships/tags", s.addTags)
+	api.Delete("/transactions/{transactionId}/relationships/tags", s.removeTags)
+	api.Get("/categories", s.listCategories)
+	api.Get("/categories/{categoryId}", s.getCategory)
+	api.Get("/tags", s.listTags)
+	api.Get("/webhooks", s.listWebhooks)
+	api.Post("/webhooks", s.createWebhook)
+	api.Get("/webhooks/{webhookId}", s.getWebhook)
+	api.Delete("/webhooks/{webhookId}", s.deleteWebhook)
+	api.Post("/webhooks/{webhookId}/ping", s.pingWebhook)
+	api.Get("/webhooks/{webhookId}/logs", s.listWebhookLogs)
+
+	r := chi.NewRouter()
+	r.Mount(strings.TrimSuffix(apiRoot, "/"), api)
+	r.Post("/_fake/transactions", s.postTransaction)
+	r.Post("/_fake/events", s.postEvent)
+	r.Put("/_fake/faults", s.putFaults)
+	r.Delete("/_fake/faults", s.deleteFaults)
+
+	s.handler = r
+
+	return s
+}
+
+// NewServer starts a fake Up API serving fixtures. Close it when done.
+func NewServer(fixtures Fixtures) *Server {
+	s := New(fixtures)
+	s.Server = httptest.NewServer(s.handler)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// BaseURL returns the API root of a server started with NewServer.
+func (s *Server) BaseURL() string {
+	return s.URL + apiRoot
+}
+
+// Client returns an Up client for a server started with NewServer.
+func (s *Server) Client(opts ...up.Option) *up.Client {
+	opts = append([]up.Option{up.WithBaseURL(s.BaseURL())}, opts...)
+	return up.NewClient("up:yeah:fake", opts...)
+}
+
+// authenticate rejects requests without a bearer token. Any token is
+// accepted.
+func authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			writeError(w, http.StatusUnauthorized, "Not Authorized")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) ping(w http.ResponseWriter, r *http.Request) {
+	var resp model.PingResponse
+	resp.Meta.Id = "fake"
+	resp.Meta.StatusEmoji = "⚡️"
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) listAccounts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	s.mu.Lock()
+	var accounts []model.AccountResource
+	for _, account := range s.accounts {
+		if !matchParam(query, "filter[accountType]", account.Attributes.AccountType) ||
+			!matchParam(query, "filter[ownershipType]", account.Attributes.OwnershipType) {
+			continue
+		}
+		accounts = append(accounts, account)
+	}
+	s.mu.Unlock()
+
+	writePage(w, r, accounts)
+}
+
+func (s *Server) getAccount(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	var resp model.GetAccountResponse
+	account, ok := s.findAccount(chi.URLParam(r, "accountId"))
+	if ok {
+		resp.Data = *account
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) listAccountTransactions(w http.ResponseWriter, r *http.Request) {
+	accountId := chi.URLParam(r, "accountId")
+
+	s.mu.Lock()
+	_, ok := s.findAccount(accountId)
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	s.writeTransactions(w, r, accountId)
+}
+
+func (s *Server) listTransactions(w http.ResponseWriter, r *http.Request) {
+	s.writeTransactions(w, r, "")
+}
+
+// writeTransactions writes a page of transactions matching the request's
+// filters, only from accountId if it is set.
+func (s *Server) writeTransactions(w http.ResponseWriter, r *http.Request, accountId string) {
+	query := r.URL.Query()
+
+	var since, until time.Time
+	for name, t := range map[string]*time.Time{"filter[since]": &since, "filter[until]": &until} {
+		if v := query.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid "+name)
+				return
+			}
+			*t = parsed
+		}
+	}
+
+	s.mu.Lock()
+	var transactions []model.TransactionResource
+	for _, transaction := range s.transactions {
+		createdAt := transaction.Attributes.CreatedAt
+		switch {
+		case accountId != "" && transaction.Relationships.Account.Data.Id != accountId,
+			!since.IsZero() && createdAt.Before(since),
+			!until.IsZero() && createdAt.After(until),
+			!matchParam(query, "filter[status]", transaction.Attributes.Status),
+			!matchCategory(query.Get("filter[category]"), transaction),
+			!matchTag(query.Get("filter[tag]"), transaction):
+			continue
+		}
+		transactions = append(transactions, transaction)
+	}
+	s.mu.Unlock()
+
+	writePage(w, r, transactions)
+}
+
+func (s *Server) getTransaction(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	var resp model.GetTransactionResponse
+	transaction, ok := s.findTransaction(chi.URLParam(r, "transactionId"))
+	if ok {
+		resp.Data = *transaction
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) updateCategory(w http.ResponseWriter, r *http.Request) {
+	var req model.UpdateTransactionCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transaction, ok := s.findTransaction(chi.URLParam(r, "transactionId"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	if !transaction.Attributes.IsCategorizable {
+		writeError(w, http.StatusForbidden, "Transaction is not categorizable")
+		return
+	}
+
+	if req.Data == nil {
+		transaction.Relationships.Category.Data = nil
+		transaction.Relationships.ParentCategory.Data = nil
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	category, ok := s.findCategory(req.Data.Id)
+	if !ok || category.Relationships.Parent.Data == nil {
+		// Only child categories can be set on a transaction
+		writeError(w, http.StatusUnprocessableEntity, "Invalid category")
+		return
+	}
+
+	transaction.Relationships.Category.Data = &resourceIdentifier{Id: category.Id, Type: "categories"}
+	transaction.Relationships.ParentCategory.Data = &resourceIdentifier{Id: category.Relationships.Parent.Data.Id, Type: "categories"}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) addTags(w http.ResponseWriter, r *http.Request) {
+	s.updateTags(w, r, func(tags []resourceIdentifier, tag string) []resourceIdentifier {
+		if slices.ContainsFunc(tags, func(t resourceIdentifier) bool { return t.Id == tag }) {
+			return tags
+		}
+		return append(tags, resourceIdentifier{Id: tag, Type: "tags"})
+	})
+}
+
+func (s *Server) removeTags(w http.ResponseWriter, r *http.Request) {
+	s.updateTags(w, r, func(tags []resourceIdentifier, tag string) []resourceIdentifier {
+		return slices.DeleteFunc(slices.Clone(tags), func(t resourceIdentifier) bool { return t.Id == tag })
+	})
+}
+
+// updateTags applies update to a transaction's tags for each tag in the
+// request.
+func (s *Server) updateTags(w http.ResponseWriter, r *http.Request, update func([]resourceIdentifier, string) []resourceIdentifier) {
+	var req model.UpdateTransactionTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transaction, ok := s.findTransaction(chi.URLParam(r, "transactionId"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	tags := transaction.Relationships.Tags.Data
+	for _, tag := range req.Data {
+		tags = update(tags, tag.Id)
+	}
+	transaction.Relationships.Tags.Data = tags
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listCategories(w http.ResponseWriter, r *http.Request) {
+	parent := r.URL.Query().Get("filter[parent]")
+
+	s.mu.Lock()
+	categories := []model.CategoryResource{}
+	for _, category := range s.categories {
+		if parent != "" {
+			p := category.Relationships.Parent.Data
+			if p == nil || p.Id != parent {
+				continue
+			}
+		}
+		categories = append(categories, category)
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, model.ListCategoriesResponse{Data: categories})
+}
+
+func (s *Server) getCategory(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	var resp model.GetCategoryResponse
+	category, ok := s.findCategory(chi.URLParam(r, "categoryId"))
+	if ok {
+		resp.Data = *category
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) listTags(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	var ids []string
+	for _, transaction := range s.transactions {
+		for _, tag := range transaction.Relationships.Tags.Data {
+			ids = append(ids, tag.Id)
+		}
+	}
+	s.mu.Unlock()
+
+	slices.Sort(ids)
+
+	var tags []model.TagResource
+	for _, id := range slices.Compact(ids) {
+		tags = append(tags, model.TagResource{Id: id, Type: "tags"})
+	}
+
+	writePage(w, r, tags)
+}
+
+// The find functions return pointers into the server's state, so s.mu must be
+// held while they are used.
+
+func (s *Server) findAccount(id string) (*model.AccountResource, bool) {
+	for i := range s.accounts {
+		if s.accounts[i].Id == id {
+			return &s.accounts[i], true
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) findTransaction(id string) (*model.TransactionResource, bool) {
+	for i := range s.transactions {
+		if s.transactions[i].Id == id {
+			return &s.transactions[i], true
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) findCategory(id string) (*model.CategoryResource, bool) {
+	for i := range s.categories {
+		if s.categories[i].Id == id {
+			return &s.categories[i], true
+		}
+	}
+	return nil, false
+}
+
+// matchParam reports whether an enum attribute matches a query parameter, if
+// it was given.
+func matchParam(query url.Values, name string, value any) bool {
+	v := query.Get(name)
+	return v == "" || fmt.Sprint(value) == v
+}
+
+func matchCategory(category string, transaction model.TransactionResource) bool {
+	if category == "" {
+		return true
+	}
+
+	for _, data := range []*resourceIdentifier{
+		transaction.Relationships.Category.Data,
+		transaction.Relationships.ParentCategory.Data,
+	} {
+		if data != nil && data.Id == category {
+			return true
+		}
+	}
+	return false
+}
+
+func matchTag(tag string, transaction model.TransactionResource) bool {
+	return tag == "" || slices.ContainsFunc(transaction.Relationships.Tags.Data, func(t resourceIdentifier) bool {
+		return t.Id == tag
+	})
+}
+
+// writePage writes the page of items after the page[after] cursor, linking to
+// the next page if there is one. The cursor is an offset into items.
+func writePage[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	query := r.URL.Query()
+
+	size := defaultPageSize
+	if v := query.Get("page[size]"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			writeError(w, http.StatusBadRequest, "Invalid page[size]")
+			return
+		}
+		size = n
+	}
+
+	after, _ := strconv.Atoi(query.Get("page[after]"))
+	start := min(max(after, 0), len(items))
+	end := min(start+size, len(items))
+
+	var resp struct {
+		Data  []T `json:"data"`
+		Links struct {
+			Prev *string `json:"prev"`
+			Next *string `json:"next"`
+		} `json:"links"`
+	}
+	resp.Data = append([]T{}, items[start:end]...)
+
+	if end < len(items) {
+		query.Set("page[after]", strconv.Itoa(end))
+		next := (&url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path, RawQuery: query.Encode()}).String()
+		resp.Links.Next = &next
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, title string) {
+	writeJSON(w, status, model.ErrorResponse{
+		Errors: []model.ErrorObject{{
+			Status: strconv.Itoa(status),
+			Title:  title,
+		}},
+	})
+}
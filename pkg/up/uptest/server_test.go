@@ -0,0 +1,272 @@
+package uptest_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baely/balance/pkg/model"
+	"github.com/baely/balance/pkg/up"
+	"github.com/baely/balance/pkg/up/uptest"
+)
+
+const spendingAccountId = "9b3a9e7c-4f6b-4c3e-9a55-1d2f0c8e7a11"
+
+var noRetry = up.WithRetryPolicy(up.RetryPolicy{MaxAttempts: 1})
+
+// newTransaction returns a debit from the spending account.
+func newTransaction(t *testing.T, cents int) model.TransactionResource {
+	t.Helper()
+
+	var transaction model.TransactionResource
+	err := json.Unmarshal([]byte(`{
+		"attributes": {
+			"description": "Corner Store",
+			"amount": {"currencyCode": "AUD", "value": "-1.00", "valueInBaseUnits": -100}
+		},
+		"relationships": {
+			"account": {"data": {"type": "accounts", "id": "`+spendingAccountId+`"}}
+		}
+	}`), &transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transaction.Attributes.Amount.ValueInBaseUnits = -cents
+
+	return transaction
+}
+
+func TestServerRequiresToken(t *testing.T) {
+	fake := uptest.NewServer(uptest.DefaultFixtures())
+	defer fake.Close()
+
+	resp, err := http.Get(fake.BaseURL() + "accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestServerServesFixtures(t *testing.T) {
+	fake := uptest.NewServer(uptest.DefaultFixtures())
+	defer fake.Close()
+
+	client := fake.Client()
+	ctx := context.Background()
+
+	accounts, err := client.ListAccounts(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts.Data) != len(uptest.DefaultFixtures().Accounts) {
+		t.Errorf("got %d accounts, want %d", len(accounts.Data), len(uptest.DefaultFixtures().Accounts))
+	}
+
+	categories, err := client.ListCategories(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(categories) == 0 {
+		t.Error("got no categories")
+	}
+
+	if _, err := client.GetAccount(ctx, "missing"); !up.IsNotFound(err) {
+		t.Errorf("GetAccount() = %v, want not found", err)
+	}
+}
+
+func TestAddTransactionMovesBalance(t *testing.T) {
+	fake := uptest.NewServer(uptest.DefaultFixtures())
+	defer fake.Close()
+
+	client := fake.Client()
+	ctx := context.Background()
+
+	transaction, err := fake.AddTransaction(newTransaction(t, 1056))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transaction.Id == "" {
+		t.Error("transaction has no ID")
+	}
+
+	got, err := client.GetTransaction(ctx, transaction.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := fmt.Sprint(got.Attributes.Status); status != "HELD" {
+		t.Errorf("status = %s, want HELD", status)
+	}
+
+	account, err := client.GetAccount(ctx, spendingAccountId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance := account.Attributes.Balance; balance.Value != "1224.00" || balance.ValueInBaseUnits != 122400 {
+		t.Errorf("balance = %s (%d), want 1224.00 (122400)", balance.Value, balance.ValueInBaseUnits)
+	}
+}
+
+func TestEmitSignsEvents(t *testing.T) {
+	const secret = "fake-secret"
+
+	events := make(chan model.WebhookEventCallback, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		if !hmac.Equal([]byte(r.Header.Get("X-Up-Authenticity-Signature")), []byte(hex.EncodeToString(mac.Sum(nil)))) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var event model.WebhookEventCallback
+		json.Unmarshal(body, &event)
+		events <- event
+	}))
+	defer receiver.Close()
+
+	fake := uptest.NewServer(uptest.DefaultFixtures())
+	defer fake.Close()
+	fake.AddWebhook(receiver.URL, secret)
+
+	transactionId := uptest.DefaultFixtures().Transactions[0].Id
+	if err := fake.Emit(context.Background(), "TRANSACTION_CREATED", transactionId); err != nil {
+		t.Fatal(err)
+	}
+
+	event := <-events
+	if eventType := fmt.Sprint(event.Data.Attributes.EventType); eventType != "TRANSACTION_CREATED" {
+		t.Errorf("event type = %s, want TRANSACTION_CREATED", eventType)
+	}
+	if event.Data.Relationships.Transaction == nil || event.Data.Relationships.Transaction.Data.Id != transactionId {
+		t.Errorf("event is not about transaction %s", transactionId)
+	}
+
+	if err := fake.Emit(context.Background(), "TRANSACTION_CREATED", "missing"); err == nil {
+		t.Error("Emit() of an unknown transaction succeeded")
+	}
+}
+
+func TestFaults(t *testing.T) {
+	fake := uptest.NewServer(uptest.DefaultFixtures())
+	defer fake.Close()
+
+	client := fake.Client(noRetry)
+	ctx := context.Background()
+
+	fake.Inject(uptest.Fault{Method: http.MethodGet, Path: "accounts/*", Status: http.StatusServiceUnavailable, RetryAfter: 2, Times: 2})
+
+	for i := 0; i < 2; i++ {
+		_, err := client.GetAccount(ctx, spendingAccountId)
+		var upErr *up.Error
+		if !errors.As(err, &upErr) || upErr.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("request %d: GetAccount() = %v, want 503", i+1, err)
+		}
+	}
+
+	// The fault only matches accounts/*, and has run out
+	if _, err := client.ListAccounts(ctx, nil); err != nil {
+		t.Errorf("ListAccounts() = %v, want nil", err)
+	}
+	if _, err := client.GetAccount(ctx, spendingAccountId); err != nil {
+		t.Errorf("GetAccount() = %v after the fault ran out", err)
+	}
+
+	fake.Inject(uptest.Fault{LatencyMs: 50})
+	start := time.Now()
+	if _, err := client.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("request took %v, want at least 50ms", elapsed)
+	}
+
+	fake.ClearFaults()
+	start = time.Now()
+	if _, err := client.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= 50*time.Millisecond {
+		t.Errorf("request took %v after clearing faults", elapsed)
+	}
+}
+
+func TestLoadFaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "faults.json")
+	err := os.WriteFile(path, []byte(`[{"method": "GET", "path": "accounts/*", "status": 429, "retry_after": 1, "times": 1}]`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	faults, err := uptest.LoadFaults(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := uptest.Fault{Method: "GET", Path: "accounts/*", Status: 429, RetryAfter: 1, Times: 1}
+	if len(faults) != 1 || faults[0] != want {
+		t.Errorf("LoadFaults() = %+v, want [%+v]", faults, want)
+	}
+}
+
+func TestControlEndpoints(t *testing.T) {
+	fake := uptest.NewServer(uptest.DefaultFixtures())
+	defer fake.Close()
+
+	resp, err := http.Post(fake.URL+"/_fake/transactions", "application/json", strings.NewReader(`{
+		"data": {
+			"attributes": {
+				"description": "Corner Store",
+				"amount": {"currencyCode": "AUD", "value": "-5.00", "valueInBaseUnits": -500}
+			},
+			"relationships": {
+				"account": {"data": {"type": "accounts", "id": "`+spendingAccountId+`"}}
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+
+	var created model.GetTransactionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.Client().GetTransaction(context.Background(), created.Data.Id); err != nil {
+		t.Errorf("GetTransaction() = %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, fake.URL+"/_fake/faults", strings.NewReader(`[{"path": "util/ping", "status": 500}]`))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if _, err := fake.Client(noRetry).Ping(context.Background()); err == nil {
+		t.Error("Ping() succeeded with a fault scripted")
+	}
+}
@@ -0,0 +1,350 @@
+package uptest
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+type webhook struct {
+	resource model.WebhookResource
+	secret   string
+	logs     []model.WebhookDeliveryLogResource
+}
+
+// AddWebhook registers a webhook with a known secret key, such as the
+// UP_WEBHOOK_SECRET of the service under test.
+func (s *Server) AddWebhook(webhookUrl, secret string) model.WebhookResource {
+	return s.addWebhook(webhookUrl, nil, secret)
+}
+
+func (s *Server) addWebhook(webhookUrl string, description *string, secret string) model.WebhookResource {
+	var resource model.WebhookResource
+	resource.Type = "webhooks"
+	resource.Id = uuid.NewString()
+	resource.Attributes.Url = webhookUrl
+	resource.Attributes.Description = description
+	resource.Attributes.CreatedAt = time.Now()
+
+	s.mu.Lock()
+	s.webhooks = append(s.webhooks, &webhook{resource: resource, secret: secret})
+	s.mu.Unlock()
+
+	return resource
+}
+
+func (s *Server) findWebhook(id string) (*webhook, bool) {
+	for _, w := range s.webhooks {
+		if w.resource.Id == id {
+			return w, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	var webhooks []model.WebhookResource
+	for _, webhook := range s.webhooks {
+		webhooks = append(webhooks, webhook.resource)
+	}
+	s.mu.Unlock()
+
+	writePage(w, r, webhooks)
+}
+
+func (s *Server) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var req model.CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Data.Attributes.Url == "" {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		writeError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	secret := hex.EncodeToString(key)
+
+	resource := s.addWebhook(req.Data.Attributes.Url, req.Data.Attributes.Description, secret)
+
+	// Up only returns the secret key when the webhook is created
+	resource.Attributes.SecretKey = &secret
+	writeJSON(w, http.StatusCreated, model.CreateWebhookResponse{Data: resource})
+}
+
+func (s *Server) getWebhook(w http.ResponseWriter, r *http.Request) {
+	var resp model.GetWebhookResponse
+	s.mu.Lock()
+	webhook, ok := s.findWebhook(chi.URLParam(r, "webhookId"))
+	if ok {
+		resp.Data = webhook.resource
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "webhookId")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, webhook := range s.webhooks {
+		if webhook.resource.Id == id {
+			s.webhooks = append(s.webhooks[:i], s.webhooks[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (s *Server) pingWebhook(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	webhook, ok := s.findWebhook(chi.URLParam(r, "webhookId"))
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	event := newEvent(webhook.resource.Id, "PING", "")
+	// A ping is reported even if the webhook fails, as Up does
+	s.deliver(r.Context(), webhook, event)
+
+	writeJSON(w, http.StatusCreated, event)
+}
+
+func (s *Server) listWebhookLogs(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	webhook, ok := s.findWebhook(chi.URLParam(r, "webhookId"))
+	var logs []model.WebhookDeliveryLogResource
+	if ok {
+		// Newest first
+		for i := len(webhook.logs) - 1; i >= 0; i-- {
+			logs = append(logs, webhook.logs[i])
+		}
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	writePage(w, r, logs)
+}
+
+// Emit sends an event about a transaction to every webhook, such as
+// TRANSACTION_CREATED. It returns the errors of any failed deliveries.
+func (s *Server) Emit(ctx context.Context, eventType, transactionId string) error {
+	s.mu.Lock()
+	_, ok := s.findTransaction(transactionId)
+	webhooks := append([]*webhook{}, s.webhooks...)
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("unknown transaction: %s", transactionId)
+	}
+
+	var errs []error
+	for _, webhook := range webhooks {
+		errs = append(errs, s.deliver(ctx, webhook, newEvent(webhook.resource.Id, eventType, transactionId)))
+	}
+
+	return errors.Join(errs...)
+}
+
+// AddTransaction adds a transaction to the top of the list and moves its
+// account's balance by its amount. Emit TRANSACTION_CREATED to tell webhooks
+// about it.
+func (s *Server) AddTransaction(transaction model.TransactionResource) (model.TransactionResource, error) {
+	if transaction.Id == "" {
+		transaction.Id = uuid.NewString()
+	}
+	transaction.Type = "transactions"
+	if transaction.Attributes.CreatedAt.IsZero() {
+		transaction.Attributes.CreatedAt = time.Now()
+	}
+	if transaction.Attributes.Status == nil {
+		transaction.Attributes.Status = "HELD"
+	}
+
+	s.mu.Lock()
+	account, ok := s.findAccount(transaction.Relationships.Account.Data.Id)
+	if !ok {
+		s.mu.Unlock()
+		return model.TransactionResource{}, fmt.Errorf("unknown account: %s", transaction.Relationships.Account.Data.Id)
+	}
+
+	balance := &account.Attributes.Balance
+	balance.ValueInBaseUnits += transaction.Attributes.Amount.ValueInBaseUnits
+	balance.Value = fmt.Sprintf("%.2f", float64(balance.ValueInBaseUnits)/100)
+
+	s.transactions = append([]model.TransactionResource{transaction}, s.transactions...)
+	s.mu.Unlock()
+
+	return transaction, nil
+}
+
+func newEvent(webhookId, eventType, transactionId string) model.WebhookEventCallback {
+	var event model.WebhookEventCallback
+	event.Data.Type = "webhook-events"
+	event.Data.Id = uuid.NewString()
+	event.Data.Attributes.EventType = eventType
+	event.Data.Attributes.CreatedAt = time.Now()
+	event.Data.Relationships.Webhook.Data.Id = webhookId
+	event.Data.Relationships.Webhook.Data.Type = "webhooks"
+
+	if transactionId != "" {
+		event.Data.Relationships.Transaction = &struct {
+			Data struct {
+				Id   string `json:"id"`
+				Type string `json:"type"`
+			} `json:"data"`
+			Links *struct {
+				Related string `json:"related"`
+			} `json:"links,omitempty"`
+		}{}
+		event.Data.Relationships.Transaction.Data.Id = transactionId
+		event.Data.Relationships.Transaction.Data.Type = "transactions"
+	}
+
+	return event
+}
+
+// deliver posts an event to a webhook, signed with its secret key in
+// X-Up-Authenticity-Signature, and logs the outcome.
+func (s *Server) deliver(ctx context.Context, webhook *webhook, event model.WebhookEventCallback) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, []byte(webhook.secret))
+	mac.Write(body)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.resource.Attributes.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Up-Authenticity-Signature", hex.EncodeToString(mac.Sum(nil)))
+
+	var log model.WebhookDeliveryLogResource
+	log.Type = "webhook-delivery-logs"
+	log.Id = uuid.NewString()
+	log.Attributes.CreatedAt = time.Now()
+	log.Attributes.Request.Body = string(body)
+	log.Relationships.WebhookEvent.Data.Id = event.Data.Id
+	log.Relationships.WebhookEvent.Data.Type = "webhook-events"
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		log.Attributes.DeliveryStatus = "UNDELIVERABLE"
+	} else {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+
+		log.Attributes.Response = &struct {
+			Body       string `json:"body"`
+			StatusCode int    `json:"statusCode"`
+		}{Body: string(respBody), StatusCode: resp.StatusCode}
+
+		log.Attributes.DeliveryStatus = "DELIVERED"
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			log.Attributes.DeliveryStatus = "BAD_RESPONSE_CODE"
+			err = fmt.Errorf("webhook %s responded with status: %d", webhook.resource.Id, resp.StatusCode)
+		}
+	}
+
+	s.mu.Lock()
+	webhook.logs = append(webhook.logs, log)
+	s.mu.Unlock()
+
+	return err
+}
+
+// eventRequest is the body of POST /_fake/events.
+type eventRequest struct {
+	EventType     string `json:"eventType"`
+	TransactionId string `json:"transactionId"`
+}
+
+func (s *Server) postEvent(w http.ResponseWriter, r *http.Request) {
+	var req eventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.EventType == "" {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := s.Emit(r.Context(), req.EventType, req.TransactionId); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) postTransaction(w http.ResponseWriter, r *http.Request) {
+	var req model.GetTransactionResponse
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	transaction, err := s.AddTransaction(req.Data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Failed deliveries show up in the webhook logs
+	if err := s.Emit(r.Context(), "TRANSACTION_CREATED", transaction.Id); err != nil {
+		fmt.Println("webhook error:", err)
+	}
+
+	writeJSON(w, http.StatusCreated, model.GetTransactionResponse{Data: transaction})
+}
+
+func (s *Server) putFaults(w http.ResponseWriter, r *http.Request) {
+	var faults []Fault
+	if err := json.NewDecoder(r.Body).Decode(&faults); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	s.ClearFaults()
+	s.Inject(faults...)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) deleteFaults(w http.ResponseWriter, r *http.Request) {
+	s.ClearFaults()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,66 @@
+package up
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+// ListWebhooks returns the first page of webhooks, oldest first.
+func (c *Client) ListWebhooks(ctx context.Context, params *model.GetWebhooksParams) (model.ListWebhooksResponse, error) {
+	var resp model.ListWebhooksResponse
+	err := c.do(ctx, http.MethodGet, c.endpoint("webhooks", encodeParams(params)), nil, &resp)
+	return resp, err
+}
+
+func (c *Client) GetWebhook(ctx context.Context, webhookId string) (model.WebhookResource, error) {
+	var resp model.GetWebhookResponse
+	if err := c.do(ctx, http.MethodGet, c.endpoint("webhooks/"+url.PathEscape(webhookId), nil), nil, &resp); err != nil {
+		return model.WebhookResource{}, err
+	}
+
+	return resp.Data, nil
+}
+
+// CreateWebhook registers a URL for webhook events. The secret key that signs
+// its events is only returned here.
+func (c *Client) CreateWebhook(ctx context.Context, webhookUrl, description string) (model.WebhookResource, error) {
+	var req model.CreateWebhookRequest
+	req.Data.Attributes.Url = webhookUrl
+	if description != "" {
+		req.Data.Attributes.Description = &description
+	}
+
+	var resp model.CreateWebhookResponse
+	if err := c.do(ctx, http.MethodPost, c.endpoint("webhooks", nil), req, &resp); err != nil {
+		return model.WebhookResource{}, err
+	}
+
+	return resp.Data, nil
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, webhookId string) error {
+	return c.do(ctx, http.MethodDelete, c.endpoint("webhooks/"+url.PathEscape(webhookId), nil), nil, nil)
+}
+
+// PingWebhook sends a PING event to a webhook and returns the event.
+func (c *Client) PingWebhook(ctx context.Context, webhookId string) (model.WebhookEventCallback, error) {
+	var resp model.WebhookEventCallback
+	err := c.do(ctx, http.MethodPost, c.endpoint("webhooks/"+url.PathEscape(webhookId)+"/ping", nil), nil, &resp)
+	return resp, err
+}
+
+// ListWebhookLogs returns the first page of delivery logs of a webhook,
+// newest first.
+func (c *Client) ListWebhookLogs(ctx context.Context, webhookId string, params *model.GetWebhooksWebhookIdLogsParams) (model.ListWebhookDeliveryLogsResponse, error) {
+	var resp model.ListWebhookDeliveryLogsResponse
+	err := c.do(ctx, http.MethodGet, c.endpoint("webhooks/"+url.PathEscape(webhookId)+"/logs", encodeParams(params)), nil, &resp)
+	return resp, err
+}
+
+// WebhookLogs iterates over every delivery log of a webhook, newest first.
+func (c *Client) WebhookLogs(ctx context.Context, webhookId string, params *model.GetWebhooksWebhookIdLogsParams) *Iterator[model.WebhookDeliveryLogResource] {
+	return newIterator[model.WebhookDeliveryLogResource](ctx, c, c.endpoint("webhooks/"+url.PathEscape(webhookId)+"/logs", encodeParams(params)))
+}
@@ -0,0 +1,143 @@
+// Package webhook signs and verifies webhooks following the Standard Webhooks
+// specification (https://www.standardwebhooks.com).
+//
+// Receivers of balance webhooks can verify a request with the secret returned
+// when they registered:
+//
+//	body, _ := io.ReadAll(r.Body)
+//	if err := webhook.Verify(secret, r.Header, body); err != nil {
+//		http.Error(w, "", http.StatusUnauthorized)
+//		return
+//	}
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderId        = "webhook-id"
+	HeaderTimestamp = "webhook-timestamp"
+	HeaderSignature = "webhook-signature"
+
+	secretPrefix     = "whsec_"
+	signatureVersion = "v1"
+)
+
+// Tolerance is how far a webhook timestamp may be from the current time
+// before Verify rejects it.
+var Tolerance = 5 * time.Minute
+
+var (
+	ErrMissingHeaders   = errors.New("missing webhook headers")
+	ErrInvalidTimestamp = errors.New("invalid webhook timestamp")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrInvalidSecret    = errors.New("invalid webhook secret")
+)
+
+// NewSecret generates a random signing secret.
+func NewSecret() (string, error) {
+	key := make([]byte, 24)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return secretPrefix + base64.StdEncoding.EncodeToString(key), nil
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, secretPrefix))
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+
+	return key, nil
+}
+
+// Sign returns the webhook-signature header value for a message.
+func Sign(secret, id string, timestamp time.Time, payload []byte) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return signatureVersion + "," + base64.StdEncoding.EncodeToString(sign(key, id, timestamp.Unix(), payload)), nil
+}
+
+// SetHeaders signs a message and sets the webhook headers on h.
+func SetHeaders(h http.Header, secret, id string, timestamp time.Time, payload []byte) error {
+	signature, err := Sign(secret, id, timestamp, payload)
+	if err != nil {
+		return err
+	}
+
+	h.Set(HeaderId, id)
+	h.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+	h.Set(HeaderSignature, signature)
+
+	return nil
+}
+
+// Verify checks that payload was signed with secret and that the signature
+// is recent.
+func Verify(secret string, h http.Header, payload []byte) error {
+	id := h.Get(HeaderId)
+	ts := h.Get(HeaderTimestamp)
+	signatures := h.Get(HeaderSignature)
+	if id == "" || ts == "" || signatures == "" {
+		return ErrMissingHeaders
+	}
+
+	timestamp, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+
+	if age := time.Since(time.Unix(timestamp, 0)); age > Tolerance || age < -Tolerance {
+		return fmt.Errorf("%w: outside tolerance", ErrInvalidTimestamp)
+	}
+
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return err
+	}
+
+	expected := sign(key, id, timestamp, payload)
+
+	// The header may carry several space delimited signatures, such as
+	// during secret rotation
+	for _, signature := range strings.Fields(signatures) {
+		version, encoded, ok := strings.Cut(signature, ",")
+		if !ok || version != signatureVersion {
+			continue
+		}
+
+		sig, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+func sign(key []byte, id string, timestamp int64, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s.%d.", id, timestamp)
+	mac.Write(payload)
+
+	return mac.Sum(nil)
+}
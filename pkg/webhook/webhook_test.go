@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte(`{"balance":"10.00"}`)
+	now := time.Now()
+
+	signed := func(secret string, timestamp time.Time) http.Header {
+		h := http.Header{}
+		if err := SetHeaders(h, secret, "msg_1", timestamp, payload); err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		payload []byte
+		want    error
+	}{
+		{
+			name:    "valid",
+			header:  signed(secret, now),
+			payload: payload,
+		},
+		{
+			name:    "tampered payload",
+			header:  signed(secret, now),
+			payload: []byte(`{"balance":"1000.00"}`),
+			want:    ErrInvalidSignature,
+		},
+		{
+			name:    "wrong secret",
+			header:  signed(other, now),
+			payload: payload,
+			want:    ErrInvalidSignature,
+		},
+		{
+			name:    "too old",
+			header:  signed(secret, now.Add(-Tolerance-time.Minute)),
+			payload: payload,
+			want:    ErrInvalidTimestamp,
+		},
+		{
+			name:    "too new",
+			header:  signed(secret, now.Add(Tolerance+time.Minute)),
+			payload: payload,
+			want:    ErrInvalidTimestamp,
+		},
+		{
+			name:    "missing headers",
+			header:  http.Header{},
+			payload: payload,
+			want:    ErrMissingHeaders,
+		},
+		{
+			name: "malformed timestamp",
+			header: func() http.Header {
+				h := http.Header{}
+				h.Set(HeaderId, "msg_1")
+				h.Set(HeaderTimestamp, "yesterday")
+				h.Set(HeaderSignature, "v1,AAAA")
+				return h
+			}(),
+			payload: payload,
+			want:    ErrInvalidTimestamp,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(secret, tt.header, tt.payload)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRotatedSecret(t *testing.T) {
+	oldSecret, _ := NewSecret()
+	newSecret, _ := NewSecret()
+
+	payload := []byte("{}")
+	now := time.Now()
+
+	oldSignature, err := Sign(oldSecret, "msg_1", now, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSignature, err := Sign(newSecret, "msg_1", now, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := http.Header{}
+	h.Set(HeaderId, "msg_1")
+	h.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	h.Set(HeaderSignature, "v2,ignored "+oldSignature+" "+newSignature)
+
+	for _, secret := range []string{oldSecret, newSecret} {
+		if err := Verify(secret, h, payload); err != nil {
+			t.Errorf("Verify() = %v, want nil", err)
+		}
+	}
+}
+
+func TestSignInvalidSecret(t *testing.T) {
+	if _, err := Sign("whsec_not base64!", "msg_1", time.Now(), nil); !errors.Is(err, ErrInvalidSecret) {
+		t.Errorf("Sign() = %v, want %v", err, ErrInvalidSecret)
+	}
+}
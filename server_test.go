@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/baely/balance/internal/database"
+	"github.com/baely/balance/internal/integrations"
+	"github.com/baely/balance/pkg/up/uptest"
+)
+
+const (
+	spendingAccountId = "9b3a9e7c-4f6b-4c3e-9a55-1d2f0c8e7a11"
+	testAdminToken    = "admin-token"
+)
+
+type testEnv struct {
+	fake    *uptest.Server
+	store   *database.MemoryClient
+	server  *Server
+	service *httptest.Server
+}
+
+// newTestEnv serves the service against a fake Up API, with in-memory
+// storage and bus.
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	fake := uptest.NewServer(uptest.DefaultFixtures())
+	t.Cleanup(fake.Close)
+
+	t.Setenv("UP_API_URL", fake.BaseURL())
+	t.Setenv("UP_TOKEN", "up:yeah:test")
+	t.Setenv("UP_WEBHOOK_SECRET", "up-secret")
+	t.Setenv("ADMIN_TOKEN", testAdminToken)
+	t.Setenv("DELIVERY_ALLOW_PRIVATE_NETWORKS", "true")
+
+	store := database.NewMemoryClient()
+	s := newServer(store, integrations.NewMemoryBus())
+
+	service := httptest.NewServer(s.Handler)
+	t.Cleanup(service.Close)
+
+	return &testEnv{fake: fake, store: store, server: s, service: service}
+}
+
+// request sends body with a bearer token, unless it is empty, and decodes a
+// successful response into v. It returns the status code. A string body is
+// sent as it is and anything else as JSON.
+func (e *testEnv) request(t *testing.T, token, method, path string, body, v any) int {
+	t.Helper()
+
+	var r io.Reader
+	if b, ok := body.(string); ok {
+		r = strings.NewReader(b)
+	} else if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, e.service.URL+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if v != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return resp.StatusCode
+}
+
+// admin is request with the admin token.
+func (e *testEnv) admin(t *testing.T, method, path string, body, v any) int {
+	t.Helper()
+	return e.request(t, testAdminToken, method, path, body, v)
+}
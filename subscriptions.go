@@ -0,0 +1,430 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+
+	"github.com/baely/balance/internal/database"
+	"github.com/baely/balance/internal/delivery"
+	"github.com/baely/balance/internal/service"
+	"github.com/baely/balance/pkg/model"
+	"github.com/baely/balance/pkg/webhook"
+)
+
+// subscriptionRequest is the body of create and update requests. Fields left
+// out of an update are unchanged, and a null filter or template is cleared.
+type subscriptionRequest struct {
+	Type        model.SubscriptionType             `json:"type"`
+	Uri         *string                            `json:"uri"`
+	Description *string                            `json:"description"`
+	Enabled     *bool                              `json:"enabled"`
+	Filter      optional[model.SubscriptionFilter] `json:"filter"`
+	Template    optional[model.PayloadTemplate]    `json:"template"`
+	Format      *model.SubscriptionFormat          `json:"format"`
+}
+
+// optional tells a field left out of a request apart from one set to null.
+type optional[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (o *optional[T]) UnmarshalJSON(b []byte) error {
+	o.Set = true
+	if string(b) == "null" {
+		o.Value = nil
+		return nil
+	}
+
+	o.Value = new(T)
+	return json.Unmarshal(b, o.Value)
+}
+
+func (s *Server) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	var req subscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Type == "" {
+		req.Type = model.SubscriptionSummary
+	}
+	if !req.Type.Valid() {
+		http.Error(w, "invalid type", http.StatusBadRequest)
+		return
+	}
+
+	if req.Uri == nil || validateUri(*req.Uri) != nil {
+		http.Error(w, "invalid uri", http.StatusBadRequest)
+		return
+	}
+
+	if req.Filter.Value != nil {
+		if err := service.ValidateFilter(*req.Filter.Value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.Template.Value != nil {
+		if err := service.ValidateTemplate(*req.Template.Value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var format model.SubscriptionFormat
+	if req.Format != nil {
+		format = *req.Format
+	}
+	if err := validateFormat(format, req.Template.Value); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Every subscriber gets its own secret to verify our deliveries with
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		fmt.Println("secret error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	subscription := model.Subscription{
+		Id:        uuid.NewString(),
+		Type:      req.Type,
+		Uri:       *req.Uri,
+		Enabled:   true,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Secret:    secret,
+		Filter:    req.Filter.Value,
+		Template:  req.Template.Value,
+		Format:    format,
+	}
+	if req.Description != nil {
+		subscription.Description = *req.Description
+	}
+	if req.Enabled != nil {
+		subscription.Enabled = *req.Enabled
+	}
+
+	if err := s.store.AddSubscription(subscription); err != nil {
+		fmt.Println("database write error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, subscription)
+}
+
+// RegisterWebhook is the original registration endpoint, kept for existing
+// callers. The body is the URI of a new summary subscription.
+//
+// Deprecated: use POST /subscriptions.
+func (s *Server) RegisterWebhook(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, 4<<10))
+	if err != nil {
+		fmt.Println("data error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	uri := strings.TrimSpace(string(data))
+	if validateUri(uri) != nil {
+		http.Error(w, "invalid uri", http.StatusBadRequest)
+		return
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		fmt.Println("secret error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	subscription := model.Subscription{
+		Id:        uuid.NewString(),
+		Type:      model.SubscriptionSummary,
+		Uri:       uri,
+		Enabled:   true,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Secret:    secret,
+	}
+
+	if err := s.store.AddSubscription(subscription); err != nil {
+		fmt.Println("database write error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, subscription)
+}
+
+func (s *Server) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subscriptionType := model.SubscriptionType(r.URL.Query().Get("type"))
+	if subscriptionType != "" && !subscriptionType.Valid() {
+		http.Error(w, "invalid type", http.StatusBadRequest)
+		return
+	}
+
+	subscriptions, err := s.store.ListSubscriptions(subscriptionType)
+	if err != nil {
+		fmt.Println("database error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	if subscriptions == nil {
+		subscriptions = []model.Subscription{}
+	}
+
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+
+	writeJSON(w, http.StatusOK, subscriptions)
+}
+
+func (s *Server) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	subscription, err := s.store.GetSubscription(chi.URLParam(r, "subscriptionId"))
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("database error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	subscription.Secret = ""
+	writeJSON(w, http.StatusOK, subscription)
+}
+
+func (s *Server) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
+	var req subscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	subscription, err := s.store.GetSubscription(chi.URLParam(r, "subscriptionId"))
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("database error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	// The type decides the payload a subscriber receives, so it is fixed
+	if req.Type != "" && req.Type != subscription.Type {
+		http.Error(w, "type cannot be changed", http.StatusBadRequest)
+		return
+	}
+
+	if req.Uri != nil {
+		if validateUri(*req.Uri) != nil {
+			http.Error(w, "invalid uri", http.StatusBadRequest)
+			return
+		}
+		subscription.Uri = *req.Uri
+	}
+	if req.Description != nil {
+		subscription.Description = *req.Description
+	}
+	// Re-enabling a subscription gives it a clean bill of health
+	reenabled := req.Enabled != nil && *req.Enabled && !subscription.Enabled
+	if req.Enabled != nil {
+		subscription.Enabled = *req.Enabled
+	}
+	// A null filter goes back to the default of the subscription's type, and
+	// a null template to the payload of its type
+	if req.Filter.Set {
+		if req.Filter.Value != nil {
+			if err := service.ValidateFilter(*req.Filter.Value); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		subscription.Filter = req.Filter.Value
+	}
+	if req.Template.Set {
+		if req.Template.Value != nil {
+			if err := service.ValidateTemplate(*req.Template.Value); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		subscription.Template = req.Template.Value
+	}
+	if req.Format != nil {
+		subscription.Format = *req.Format
+	}
+	if err := validateFormat(subscription.Format, subscription.Template); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	subscription.UpdatedAt = time.Now().UTC()
+
+	err = s.store.UpdateSubscription(subscription)
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("database write error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	if reenabled {
+		subscription.Health, err = s.store.UpdateSubscriptionHealth(subscription.Id, func(health *model.SubscriptionHealth) bool {
+			*health = model.SubscriptionHealth{}
+			return true
+		})
+		if err != nil {
+			fmt.Println("database write error:", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	subscription.Secret = ""
+	writeJSON(w, http.StatusOK, subscription)
+}
+
+// RotateSubscriptionSecret replaces a subscription's signing secret and
+// returns the new one. Subscriptions carried over from before signing have
+// no secret, and their deliveries are unsigned until it is rotated.
+func (s *Server) RotateSubscriptionSecret(w http.ResponseWriter, r *http.Request) {
+	subscription, err := s.store.GetSubscription(chi.URLParam(r, "subscriptionId"))
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("database error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		fmt.Println("secret error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	subscription.Secret = secret
+	subscription.UpdatedAt = time.Now().UTC()
+
+	err = s.store.UpdateSubscription(subscription)
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("database write error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, subscription)
+}
+
+func (s *Server) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	err := s.store.DeleteSubscription(chi.URLParam(r, "subscriptionId"))
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("database write error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validateUri(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid uri: %q", s)
+	}
+
+	return nil
+}
+
+// validateFormat checks a subscription format. CloudEvents carry the raw
+// event as their data, so they cannot be combined with a template.
+func validateFormat(format model.SubscriptionFormat, template *model.PayloadTemplate) error {
+	if !format.Valid() {
+		return fmt.Errorf("invalid format: %q", format)
+	}
+
+	if format != "" && template != nil {
+		return errors.New("format cannot be used with a template")
+	}
+
+	return nil
+}
+
+// enabledSubscriptions drops subscriptions that are switched off.
+func enabledSubscriptions(subscriptions []model.Subscription) []model.Subscription {
+	var enabled []model.Subscription
+	for _, subscription := range subscriptions {
+		if subscription.Enabled {
+			enabled = append(enabled, subscription)
+		}
+	}
+
+	return enabled
+}
+
+// subscriptionPayload builds the delivery of an event to a subscription from
+// its format or template, falling back to the prebuilt payload of its type. ok
+// is false if there is nothing to send, such as a summary of a credit.
+func (s *Server) subscriptionPayload(
+	subscription model.Subscription,
+	event service.EventData,
+	payloads map[model.SubscriptionType][]byte,
+) (payload delivery.Payload, ok bool, err error) {
+	switch {
+	case subscription.Format != "":
+		e, err := service.NewCloudEvent(s.cloudEventsSource, event)
+		if err != nil {
+			return delivery.Payload{}, false, err
+		}
+		payload.Body, payload.ContentType, payload.Headers, err = service.CloudEventPayload(e, subscription.Format)
+		return payload, err == nil, err
+	case subscription.Template != nil:
+		payload.Body, payload.ContentType, err = service.RenderTemplate(*subscription.Template, event)
+		return payload, err == nil, err
+	default:
+		payload.Body, ok = payloads[subscription.Type]
+		payload.ContentType = "application/json"
+		return payload, ok, nil
+	}
+}
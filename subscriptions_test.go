@@ -0,0 +1,234 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+func TestSubscriptionsRequireAdmin(t *testing.T) {
+	env := newTestEnv(t)
+
+	for _, token := range []string{"", "wrong"} {
+		for _, req := range []struct{ method, path string }{
+			{http.MethodGet, "/subscriptions"},
+			{http.MethodPost, "/subscriptions"},
+			{http.MethodPost, "/register"},
+			{http.MethodGet, "/debug/vars"},
+		} {
+			if status := env.request(t, token, req.method, req.path, "https://example.com", nil); status != http.StatusUnauthorized {
+				t.Errorf("%s %s = %d with token %q, want %d", req.method, req.path, status, token, http.StatusUnauthorized)
+			}
+		}
+	}
+
+	if status := env.admin(t, http.MethodGet, "/debug/vars", nil, nil); status != http.StatusOK {
+		t.Errorf("status = %d with the admin token, want %d", status, http.StatusOK)
+	}
+}
+
+func TestSubscriptionCRUD(t *testing.T) {
+	env := newTestEnv(t)
+
+	var created model.Subscription
+	status := env.admin(t, http.MethodPost, "/subscriptions", map[string]any{
+		"uri":         "https://example.com/summary",
+		"description": "Spending notifications",
+	}, &created)
+	if status != http.StatusCreated {
+		t.Fatalf("create status = %d, want %d", status, http.StatusCreated)
+	}
+	if created.Type != model.SubscriptionSummary || !created.Enabled || created.Secret == "" {
+		t.Errorf("created %+v, want an enabled summary subscription with a secret", created)
+	}
+
+	var raw model.Subscription
+	if status := env.admin(t, http.MethodPost, "/subscriptions", map[string]any{"type": "raw", "uri": "https://example.com/raw"}, &raw); status != http.StatusCreated {
+		t.Fatalf("create status = %d, want %d", status, http.StatusCreated)
+	}
+
+	// Secrets are only returned when they are made
+	var got model.Subscription
+	if status := env.admin(t, http.MethodGet, "/subscriptions/"+created.Id, nil, &got); status != http.StatusOK {
+		t.Fatalf("get status = %d, want %d", status, http.StatusOK)
+	}
+	if got.Uri != created.Uri || got.Description != "Spending notifications" || got.Secret != "" {
+		t.Errorf("got %+v, want %s without its secret", got, created.Uri)
+	}
+
+	var list []model.Subscription
+	if status := env.admin(t, http.MethodGet, "/subscriptions?type=raw", nil, &list); status != http.StatusOK {
+		t.Fatalf("list status = %d, want %d", status, http.StatusOK)
+	}
+	if len(list) != 1 || list[0].Id != raw.Id || list[0].Secret != "" {
+		t.Errorf("raw subscriptions = %+v, want only %s without its secret", list, raw.Id)
+	}
+
+	var updated model.Subscription
+	status = env.admin(t, http.MethodPatch, "/subscriptions/"+created.Id, map[string]any{
+		"uri":     "https://example.com/moved",
+		"enabled": false,
+	}, &updated)
+	if status != http.StatusOK {
+		t.Fatalf("update status = %d, want %d", status, http.StatusOK)
+	}
+	if updated.Uri != "https://example.com/moved" || updated.Enabled || updated.Description != "Spending notifications" {
+		t.Errorf("updated %+v, want a disabled subscription at the new uri keeping its description", updated)
+	}
+
+	// Updates keep the secret
+	stored, err := env.store.GetSubscription(created.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Secret != created.Secret {
+		t.Error("update changed the secret")
+	}
+
+	if status := env.admin(t, http.MethodPatch, "/subscriptions/"+created.Id, map[string]any{"type": "raw"}, nil); status != http.StatusBadRequest {
+		t.Errorf("type change status = %d, want %d", status, http.StatusBadRequest)
+	}
+
+	if status := env.admin(t, http.MethodDelete, "/subscriptions/"+created.Id, nil, nil); status != http.StatusNoContent {
+		t.Fatalf("delete status = %d, want %d", status, http.StatusNoContent)
+	}
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/subscriptions/" + created.Id},
+		{http.MethodPatch, "/subscriptions/" + created.Id},
+		{http.MethodDelete, "/subscriptions/" + created.Id},
+	} {
+		if status := env.admin(t, req.method, req.path, map[string]any{}, nil); status != http.StatusNotFound {
+			t.Errorf("%s %s = %d after deleting, want %d", req.method, req.path, status, http.StatusNotFound)
+		}
+	}
+}
+
+func TestSubscriptionValidation(t *testing.T) {
+	env := newTestEnv(t)
+
+	for _, body := range []any{
+		"not json",
+		map[string]any{},
+		map[string]any{"uri": "ftp://example.com"},
+		map[string]any{"uri": "https://"},
+		map[string]any{"uri": "https://example.com", "type": "everything"},
+		map[string]any{"uri": "https://example.com", "format": "xml"},
+		map[string]any{"uri": "https://example.com", "filter": map[string]any{"direction": "sideways"}},
+		map[string]any{"uri": "https://example.com", "filter": map[string]any{"min_amount": 10, "max_amount": 5}},
+		map[string]any{"uri": "https://example.com", "filter": map[string]any{"expression": "1 +"}},
+		map[string]any{"uri": "https://example.com", "filter": map[string]any{"expression": "transaction.attributes.description"}},
+		map[string]any{"uri": "https://example.com", "template": map[string]any{"body": "{{.EventId"}},
+		map[string]any{"uri": "https://example.com", "format": "cloudevents", "template": map[string]any{"body": "{{.EventId}}"}},
+	} {
+		if status := env.admin(t, http.MethodPost, "/subscriptions", body, nil); status != http.StatusBadRequest {
+			t.Errorf("create %v = %d, want %d", body, status, http.StatusBadRequest)
+		}
+	}
+
+	var created model.Subscription
+	if status := env.admin(t, http.MethodPost, "/subscriptions", map[string]any{"uri": "https://example.com"}, &created); status != http.StatusCreated {
+		t.Fatalf("create status = %d, want %d", status, http.StatusCreated)
+	}
+	for _, body := range []map[string]any{
+		{"uri": "example.com"},
+		{"filter": map[string]any{"expression": "42"}},
+		{"format": "cloudevents-binary", "template": map[string]any{"body": "{{.EventId}}"}},
+	} {
+		if status := env.admin(t, http.MethodPatch, "/subscriptions/"+created.Id, body, nil); status != http.StatusBadRequest {
+			t.Errorf("update %v = %d, want %d", body, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestRegisterWebhook(t *testing.T) {
+	env := newTestEnv(t)
+
+	var registered model.Subscription
+	if status := env.admin(t, http.MethodPost, "/register", " https://example.com/legacy\n", &registered); status != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", status, http.StatusCreated)
+	}
+	if registered.Type != model.SubscriptionSummary || registered.Uri != "https://example.com/legacy" || registered.Secret == "" {
+		t.Errorf("registered %+v, want a summary subscription with a secret", registered)
+	}
+
+	if status := env.admin(t, http.MethodPost, "/register", "not a uri", nil); status != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestRotateSubscriptionSecret(t *testing.T) {
+	env := newTestEnv(t)
+
+	// A subscriber carried over from before deliveries were signed
+	err := env.store.AddSubscription(model.Subscription{
+		Id:      "webhook-1",
+		Type:    model.SubscriptionSummary,
+		Uri:     "https://example.com/summary",
+		Enabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rotated model.Subscription
+	if status := env.admin(t, http.MethodPost, "/subscriptions/webhook-1/secret", nil, &rotated); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	if rotated.Secret == "" {
+		t.Fatal("rotated secret is empty")
+	}
+
+	stored, err := env.store.GetSubscription("webhook-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Secret != rotated.Secret {
+		t.Errorf("stored secret = %q, want %q", stored.Secret, rotated.Secret)
+	}
+
+	// Rotating again replaces the secret
+	var again model.Subscription
+	if status := env.admin(t, http.MethodPost, "/subscriptions/webhook-1/secret", nil, &again); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	if again.Secret == rotated.Secret {
+		t.Error("secret was not replaced")
+	}
+
+	if status := env.admin(t, http.MethodPost, "/subscriptions/missing/secret", nil, nil); status != http.StatusNotFound {
+		t.Errorf("status = %d for a missing subscription, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestReenableSubscription(t *testing.T) {
+	env := newTestEnv(t)
+
+	err := env.store.AddSubscription(model.Subscription{Id: "sub_1", Type: model.SubscriptionSummary, Uri: "https://example.com", Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = env.store.UpdateSubscriptionHealth("sub_1", func(health *model.SubscriptionHealth) bool {
+		now := time.Now()
+		*health = model.SubscriptionHealth{ConsecutiveFailures: 9, FailingSince: &now, CircuitOpen: true, NextProbeAt: &now, DisabledAt: &now}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.store.DisableSubscription("sub_1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	var updated model.Subscription
+	if status := env.admin(t, http.MethodPatch, "/subscriptions/sub_1", map[string]any{"enabled": true}, &updated); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	if !updated.Enabled || updated.Health != (model.SubscriptionHealth{}) {
+		t.Errorf("got %+v, want it enabled with a clean bill of health", updated)
+	}
+	if stored, err := env.store.GetSubscription("sub_1"); err != nil || stored.Health != (model.SubscriptionHealth{}) {
+		t.Errorf("stored health = %+v, %v, want a clean bill", stored.Health, err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/baely/balance/internal/integrations"
+	"github.com/baely/balance/pkg/model"
+	"github.com/baely/balance/pkg/up"
+)
+
+// runWorker pulls webhook events from the named subscription and processes
+// them with at most concurrency events in flight. It returns once ctx is done
+// and every in-flight event has been acked or nacked.
+func (s *Server) runWorker(ctx context.Context, subscription string, concurrency int) error {
+	msgs, err := s.bus.Subscribe(ctx, integrations.WebhookEventsTopic, subscription)
+	if err != nil {
+		return err
+	}
+
+	s.consume(ctx, msgs, subscription, concurrency)
+
+	return nil
+}
+
+// consume processes webhook events from msgs until it is closed.
+func (s *Server) consume(ctx context.Context, msgs <-chan *integrations.Message, subscription string, concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	fmt.Println("worker started. subscription:", subscription, "concurrency:", concurrency)
+
+	// In-flight events are allowed to finish after shutdown is requested
+	processCtx := context.WithoutCancel(ctx)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range msgs {
+				s.handleMessage(processCtx, msg)
+			}
+		}()
+	}
+
+	wg.Wait()
+	fmt.Println("worker stopped")
+}
+
+func (s *Server) handleMessage(ctx context.Context, msg *integrations.Message) {
+	var upEvent model.WebhookEventCallback
+	if err := json.Unmarshal(msg.Data, &upEvent); err != nil {
+		// Malformed events will never succeed, so don't redeliver them
+		fmt.Println("unmarshall error:", err, "message:", msg.ID)
+		msg.Ack()
+		return
+	}
+
+	if err := s.processEvent(ctx, upEvent); err != nil {
+		fmt.Println("process error:", err, "message:", msg.ID)
+		if permanent(err) {
+			fmt.Println("dropping event that cannot be processed:", upEvent.Data.Id)
+			msg.Ack()
+			return
+		}
+		msg.Nack()
+		return
+	}
+
+	msg.Ack()
+}
+
+// permanent reports whether processing an event failed in a way that retrying
+// will not fix, such as the transaction of a TRANSACTION_DELETED event being
+// gone or UP_TOKEN being rejected.
+func permanent(err error) bool {
+	var upErr *up.Error
+	return errors.As(err, &upErr) && !upErr.Temporary()
+}